@@ -0,0 +1,323 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Awareness
+//
+// Awareness carries ephemeral per-replica state such as a user name, colour,
+// cursors or selected element IDs. It is independent of any MArrayCRDT: each
+// replica numbers its own state changes with a private counter, so presence
+// traffic never touches the vector clocks or the persisted history.
+//
+// A replica owns only its own entry. An update for a peer is accepted when
+// its counter is newer than the one known, so stale or reordered updates are
+// ignored; a cleared state is sent as null and removes the peer everywhere.
+// Entries that are not refreshed within the timeout are forgotten together
+// with their counter. Call Tick periodically: it drops silent peers and
+// renews the local state after half the timeout, reporting that the renewal
+// should be broadcast.
+//
+// A peer that restarts under the same replica ID counts from 1 again. Its
+// updates are ignored while the entry of its previous run is still known, so
+// that entry stops being refreshed and times out, after which the restarted
+// peer is accepted like a new one.
+//
+// Updates are JSON objects keyed by replica ID:
+//
+//	{"replica1": {"clock": 4, "state": <S as JSON>}, "site2": {"clock": 9, "state": null}}
+
+// DefaultAwarenessTimeout is how long a peer's state survives without updates
+const DefaultAwarenessTimeout = 30 * time.Second
+
+// Awareness holds the ephemeral state of every known replica
+type Awareness[S any] struct {
+	mu        sync.Mutex
+	replicaID string
+	timeout   time.Duration
+	now       func() time.Time
+
+	entries   map[string]*awarenessEntry[S]
+	observers []func(event AwarenessEvent)
+}
+
+// awarenessEntry is the latest known state of one replica
+type awarenessEntry[S any] struct {
+	clock   uint64
+	state   S
+	present bool      // false once cleared
+	seen    time.Time // local time of the last update
+}
+
+// AwarenessEvent lists the replicas whose state appeared, changed or went
+// away in one call. Local is set for changes of this replica's own state.
+type AwarenessEvent struct {
+	Added   []string
+	Updated []string
+	Removed []string
+	Local   bool
+}
+
+// awarenessUpdate is the wire form of one entry
+type awarenessUpdate struct {
+	Clock uint64          `json:"clock"`
+	State json.RawMessage `json:"state"`
+}
+
+// NewAwareness creates the awareness state of a replica. A non-positive
+// timeout uses DefaultAwarenessTimeout.
+func NewAwareness[S any](replicaID string, timeout time.Duration) *Awareness[S] {
+	if timeout <= 0 {
+		timeout = DefaultAwarenessTimeout
+	}
+
+	return &Awareness[S]{
+		replicaID: replicaID,
+		timeout:   timeout,
+		now:       time.Now,
+		entries:   make(map[string]*awarenessEntry[S]),
+	}
+}
+
+// SetLocalState replaces the state of this replica
+func (a *Awareness[S]) SetLocalState(state S) {
+	a.mu.Lock()
+	event := a.setLocalLocked(state, true)
+	a.mu.Unlock()
+
+	a.notify(event)
+}
+
+// ClearLocalState removes the state of this replica, for example when the
+// user goes offline
+func (a *Awareness[S]) ClearLocalState() {
+	var zero S
+	a.mu.Lock()
+	event := a.setLocalLocked(zero, false)
+	a.mu.Unlock()
+
+	a.notify(event)
+}
+
+// setLocalLocked stamps a new local entry (must hold lock)
+func (a *Awareness[S]) setLocalLocked(state S, present bool) AwarenessEvent {
+	event := AwarenessEvent{Local: true}
+	local, exists := a.entries[a.replicaID]
+	switch {
+	case present && (!exists || !local.present):
+		event.Added = []string{a.replicaID}
+	case present && !reflect.DeepEqual(local.state, state):
+		event.Updated = []string{a.replicaID}
+	case !present && exists && local.present:
+		event.Removed = []string{a.replicaID}
+	}
+
+	var clock uint64
+	if exists {
+		clock = local.clock
+	}
+	a.entries[a.replicaID] = &awarenessEntry[S]{
+		clock:   clock + 1,
+		state:   state,
+		present: present,
+		seen:    a.now(),
+	}
+	return event
+}
+
+// LocalState returns the state of this replica
+func (a *Awareness[S]) LocalState() (S, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if local, ok := a.entries[a.replicaID]; ok && local.present {
+		return local.state, true
+	}
+	var zero S
+	return zero, false
+}
+
+// States returns the state of every present replica, including this one
+func (a *Awareness[S]) States() map[string]S {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	states := make(map[string]S, len(a.entries))
+	for replica, entry := range a.entries {
+		if entry.present {
+			states[replica] = entry.state
+		}
+	}
+	return states
+}
+
+// Observe registers a handler for awareness changes. Handlers run after the
+// lock has been released.
+func (a *Awareness[S]) Observe(handler func(event AwarenessEvent)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.observers = append(a.observers, handler)
+}
+
+// EncodeUpdate encodes the entries of the given replicas, or of every known
+// replica when none are given
+func (a *Awareness[S]) EncodeUpdate(replicaIDs ...string) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(replicaIDs) == 0 {
+		for replica := range a.entries {
+			replicaIDs = append(replicaIDs, replica)
+		}
+	}
+
+	update := make(map[string]awarenessUpdate, len(replicaIDs))
+	for _, replica := range replicaIDs {
+		entry, ok := a.entries[replica]
+		if !ok {
+			continue
+		}
+
+		state := json.RawMessage("null")
+		if entry.present {
+			data, err := json.Marshal(entry.state)
+			if err != nil {
+				return nil, fmt.Errorf("marraycrdt: encode awareness of %s: %w", replica, err)
+			}
+			state = data
+		}
+		update[replica] = awarenessUpdate{Clock: entry.clock, State: state}
+	}
+	return json.Marshal(update)
+}
+
+// ApplyUpdate folds in an update produced by EncodeUpdate on another replica.
+// Entries for this replica are ignored; nothing is applied if the update is
+// malformed.
+func (a *Awareness[S]) ApplyUpdate(data []byte) error {
+	var update map[string]awarenessUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		return fmt.Errorf("%w: awareness update: %v", ErrInvalidEncoding, err)
+	}
+
+	// Decode every state before touching anything
+	states := make(map[string]*S, len(update))
+	for replica, u := range update {
+		if len(u.State) == 0 || string(u.State) == "null" {
+			states[replica] = nil
+			continue
+		}
+		var state S
+		if err := json.Unmarshal(u.State, &state); err != nil {
+			return fmt.Errorf("%w: awareness state of %s: %v", ErrInvalidEncoding, replica, err)
+		}
+		states[replica] = &state
+	}
+
+	replicas := make([]string, 0, len(update))
+	for replica := range update {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+
+	a.mu.Lock()
+	var event AwarenessEvent
+	now := a.now()
+	for _, replica := range replicas {
+		if replica == a.replicaID {
+			continue
+		}
+		clock, state := update[replica].Clock, states[replica]
+
+		known, exists := a.entries[replica]
+		if exists && clock < known.clock {
+			continue
+		}
+		if exists && clock == known.clock && (state != nil || !known.present) {
+			// Same update again; it still proves the peer is alive
+			known.seen = now
+			continue
+		}
+
+		entry := &awarenessEntry[S]{clock: clock, present: state != nil, seen: now}
+		if state != nil {
+			entry.state = *state
+		}
+		switch {
+		case entry.present && (!exists || !known.present):
+			event.Added = append(event.Added, replica)
+		case entry.present && !reflect.DeepEqual(known.state, entry.state):
+			event.Updated = append(event.Updated, replica)
+		case !entry.present && exists && known.present:
+			event.Removed = append(event.Removed, replica)
+		}
+		a.entries[replica] = entry
+	}
+	a.mu.Unlock()
+
+	a.notify(event)
+	return nil
+}
+
+// Tick forgets peers that have been silent for the timeout and renews the
+// local state once half of it has passed. It reports whether the local state
+// was renewed; the caller should then broadcast EncodeUpdate(replicaID).
+func (a *Awareness[S]) Tick() bool {
+	a.mu.Lock()
+	var event AwarenessEvent
+	renewed := false
+	now := a.now()
+
+	replicas := make([]string, 0, len(a.entries))
+	for replica := range a.entries {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+
+	for _, replica := range replicas {
+		entry := a.entries[replica]
+		age := now.Sub(entry.seen)
+
+		if replica == a.replicaID {
+			if entry.present && age >= a.timeout/2 {
+				entry.clock++
+				entry.seen = now
+				renewed = true
+			}
+			continue
+		}
+		if age >= a.timeout {
+			// Forget the counter too, so a restarted peer is accepted again
+			delete(a.entries, replica)
+			if entry.present {
+				event.Removed = append(event.Removed, replica)
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	a.notify(event)
+	return renewed
+}
+
+// notify delivers an event to the observers unless it is empty
+func (a *Awareness[S]) notify(event AwarenessEvent) {
+	if len(event.Added)+len(event.Updated)+len(event.Removed) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	observers := a.observers
+	a.mu.Unlock()
+
+	for _, handler := range observers {
+		handler(event)
+	}
+}
@@ -0,0 +1,173 @@
+package marraycrdt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// presence is the awareness state used in the tests
+type presence struct {
+	Name     string   `json:"name"`
+	Color    string   `json:"color"`
+	Selected []string `json:"selected,omitempty"`
+	Cursor   *Cursor  `json:"cursor,omitempty"`
+}
+
+// newTestAwareness returns an awareness instance with a controllable clock
+func newTestAwareness(replicaID string, now *time.Time) *Awareness[presence] {
+	a := NewAwareness[presence](replicaID, 10*time.Second)
+	a.now = func() time.Time { return *now }
+	return a
+}
+
+// exchange sends the full awareness state of from to to
+func exchange(t *testing.T, from, to *Awareness[presence]) {
+	t.Helper()
+	data, err := from.EncodeUpdate()
+	if err != nil {
+		t.Fatalf("EncodeUpdate failed: %v", err)
+	}
+	if err := to.ApplyUpdate(data); err != nil {
+		t.Fatalf("ApplyUpdate failed: %v", err)
+	}
+}
+
+// TestAwarenessExchange tests propagation of states and their change events
+func TestAwarenessExchange(t *testing.T) {
+	now := time.Unix(0, 0)
+	alice := newTestAwareness("replica1", &now)
+	bob := newTestAwareness("site2", &now)
+
+	var events []AwarenessEvent
+	bob.Observe(func(event AwarenessEvent) { events = append(events, event) })
+
+	cursor := New[string]("replica1").CursorAt(0, SideAfter)
+	alice.SetLocalState(presence{Name: "Alice", Color: "red", Cursor: &cursor})
+	bob.SetLocalState(presence{Name: "Bob", Color: "blue"})
+	exchange(t, alice, bob)
+	exchange(t, bob, alice)
+
+	if !reflect.DeepEqual(alice.States(), bob.States()) || len(bob.States()) != 2 {
+		t.Errorf("States did not converge! R1: %v, R2: %v", alice.States(), bob.States())
+	}
+
+	alice.SetLocalState(presence{Name: "Alice", Color: "red", Selected: []string{"id1"}})
+	exchange(t, alice, bob)
+	exchange(t, alice, bob) // repeated updates change nothing
+	alice.ClearLocalState()
+	exchange(t, alice, bob)
+
+	if _, ok := bob.States()["replica1"]; ok {
+		t.Errorf("Cleared state should be removed")
+	}
+	expected := []AwarenessEvent{
+		{Added: []string{"site2"}, Local: true},
+		{Added: []string{"replica1"}},
+		{Updated: []string{"replica1"}},
+		{Removed: []string{"replica1"}},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, events)
+	}
+}
+
+// TestAwarenessTimeout tests that silent peers expire and Tick renews the local state
+func TestAwarenessTimeout(t *testing.T) {
+	now := time.Unix(0, 0)
+	alice := newTestAwareness("replica1", &now)
+	bob := newTestAwareness("site2", &now)
+
+	alice.SetLocalState(presence{Name: "Alice"})
+	bob.SetLocalState(presence{Name: "Bob"})
+	exchange(t, alice, bob)
+	exchange(t, bob, alice)
+
+	// Alice keeps renewing, Bob goes silent
+	for i := 0; i < 3; i++ {
+		now = now.Add(6 * time.Second)
+		if !alice.Tick() {
+			t.Fatalf("Tick should renew the local state")
+		}
+		data, _ := alice.EncodeUpdate("replica1")
+		_ = bob.ApplyUpdate(data)
+		bob.Tick()
+	}
+
+	if _, ok := alice.States()["site2"]; ok {
+		t.Errorf("Silent peer should have timed out")
+	}
+	if _, ok := bob.States()["replica1"]; !ok {
+		t.Errorf("Renewed peer should still be present")
+	}
+	if _, ok := bob.LocalState(); !ok {
+		t.Errorf("The local state never times out")
+	}
+}
+
+// TestAwarenessPeerRestart tests that a peer restarting under the same ID is accepted once its old entry timed out
+func TestAwarenessPeerRestart(t *testing.T) {
+	now := time.Unix(0, 0)
+	alice := newTestAwareness("replica1", &now)
+	bob := newTestAwareness("site2", &now)
+
+	for i := 0; i < 5; i++ {
+		alice.SetLocalState(presence{Name: "Alice"})
+	}
+	exchange(t, alice, bob)
+
+	// Alice crashes and comes back with a fresh counter
+	now = now.Add(4 * time.Second)
+	alice = newTestAwareness("replica1", &now)
+	alice.SetLocalState(presence{Name: "Alice again"})
+	exchange(t, alice, bob)
+	if bob.States()["replica1"].Name != "Alice" {
+		t.Errorf("Update with an older counter should be ignored while the old entry is live")
+	}
+
+	// Without refreshes the old entry times out and the restarted peer is accepted
+	now = now.Add(6 * time.Second)
+	bob.Tick()
+	if _, ok := bob.States()["replica1"]; ok {
+		t.Fatalf("Old entry should have timed out")
+	}
+	exchange(t, alice, bob)
+	if state, ok := bob.States()["replica1"]; !ok || state.Name != "Alice again" {
+		t.Errorf("Restarted peer was not accepted: %v", bob.States())
+	}
+}
+
+// TestAwarenessIgnoresStaleUpdates tests reordered, foreign and malformed updates
+func TestAwarenessIgnoresStaleUpdates(t *testing.T) {
+	now := time.Unix(0, 0)
+	alice := newTestAwareness("replica1", &now)
+	bob := newTestAwareness("site2", &now)
+
+	alice.SetLocalState(presence{Name: "old"})
+	stale, _ := alice.EncodeUpdate()
+	alice.SetLocalState(presence{Name: "new"})
+	exchange(t, alice, bob)
+
+	if err := bob.ApplyUpdate(stale); err != nil {
+		t.Fatalf("ApplyUpdate failed: %v", err)
+	}
+	if bob.States()["replica1"].Name != "new" {
+		t.Errorf("Stale update overwrote newer state: %v", bob.States())
+	}
+
+	// Nobody else can overwrite the local state
+	bob.SetLocalState(presence{Name: "Bob"})
+	_ = alice.ApplyUpdate([]byte(`{"site2": {"clock": 1, "state": {"name": "Bob"}}, "replica1": {"clock": 99, "state": null}}`))
+	if state, ok := alice.LocalState(); !ok || state.Name != "new" {
+		t.Errorf("Remote update replaced the local state")
+	}
+
+	before := bob.States()
+	if err := bob.ApplyUpdate([]byte(`{"x": {"clock": 1, "state": 5}}`)); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected ErrInvalidEncoding, got %v", err)
+	}
+	if !reflect.DeepEqual(before, bob.States()) {
+		t.Errorf("Malformed update must not change anything")
+	}
+}
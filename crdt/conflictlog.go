@@ -0,0 +1,199 @@
+package marraycrdt
+
+import (
+	"sync"
+	"time"
+)
+
+// Conflict log
+//
+// A ConflictLog attached with WithConflictLog records every decision a merge
+// takes between two concurrent writes of the same field: concurrent Sets,
+// concurrent moves, and a delete racing a move. Each record keeps both
+// candidate clocks, which one won and the rule that picked it, so the losing
+// write can be traced after the fact. Causally ordered writes are not
+// conflicts and are not recorded. One log may be shared by several replicas;
+// records name the replica that merged.
+
+// ConflictField names the element field two writes conflicted on
+type ConflictField string
+
+const (
+	// FieldValue is a conflict between concurrent Sets
+	FieldValue ConflictField = "value"
+	// FieldIndex is a conflict between concurrent moves
+	FieldIndex ConflictField = "index"
+	// FieldDelete is a conflict between a delete and a concurrent move
+	FieldDelete ConflictField = "delete"
+)
+
+// ConflictRule names the rule that picked the winner
+type ConflictRule string
+
+const (
+	// RuleTimestamp: the later hybrid timestamp won, see WithHybridClock
+	RuleTimestamp ConflictRule = "timestamp"
+	// RuleMaxReplica: the clock naming the highest replica ID won
+	RuleMaxReplica ConflictRule = "max-replica"
+	// RuleClockOrder: both clocks named the same highest replica, so their
+	// counters were compared entry by entry
+	RuleClockOrder ConflictRule = "clock-order"
+	// RuleResolver: the configured ValueResolver decided
+	RuleResolver ConflictRule = "resolver"
+	// RuleSiblings: multi-value mode kept both values
+	RuleSiblings ConflictRule = "siblings"
+)
+
+// ConflictCandidate is one of the two conflicting writes. Source is "local"
+// or "remote", or for delete conflicts one of "local-delete",
+// "remote-delete", "local-move" and "remote-move".
+type ConflictCandidate struct {
+	Source string
+	Clock  *VectorClock
+	Time   Timestamp
+}
+
+// ConflictRecord describes one decision between concurrent writes. Winner
+// is the Source of the winning candidate, or "both" when they were combined.
+type ConflictRecord struct {
+	Replica    string
+	ElementID  string
+	Field      ConflictField
+	Candidates [2]ConflictCandidate
+	Winner     string
+	Rule       ConflictRule
+	At         time.Time
+}
+
+// ConflictLog collects conflict records
+type ConflictLog struct {
+	mu      sync.Mutex
+	limit   int
+	records []ConflictRecord
+}
+
+// NewConflictLog creates a log that keeps the latest limit records, or all of
+// them if limit is not positive
+func NewConflictLog(limit int) *ConflictLog {
+	return &ConflictLog{limit: limit}
+}
+
+// WithConflictLog records the conflicts resolved by Merge and Apply in log
+func WithConflictLog(log *ConflictLog) Option {
+	return func(c *Config) {
+		c.ConflictLog = log
+	}
+}
+
+// Records returns the recorded conflicts, oldest first
+func (l *ConflictLog) Records() []ConflictRecord {
+	return l.Query(func(ConflictRecord) bool { return true })
+}
+
+// ForElement returns the recorded conflicts of one element, oldest first
+func (l *ConflictLog) ForElement(id string) []ConflictRecord {
+	return l.Query(func(r ConflictRecord) bool { return r.ElementID == id })
+}
+
+// Query returns the recorded conflicts that match, oldest first
+func (l *ConflictLog) Query(match func(r ConflictRecord) bool) []ConflictRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var matched []ConflictRecord
+	for _, r := range l.records {
+		if match(r) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Len returns the number of records held
+func (l *ConflictLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.records)
+}
+
+// Clear drops every record
+func (l *ConflictLog) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = nil
+}
+
+// add appends a record, dropping the oldest beyond the limit
+func (l *ConflictLog) add(r ConflictRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = append(l.records, r)
+	if l.limit > 0 && len(l.records) > l.limit {
+		l.records = append(l.records[:0:0], l.records[len(l.records)-l.limit:]...)
+	}
+}
+
+// logConflictLocked records a decision about elem if a log is attached. It is
+// called before elem's clock absorbs the merge, so a decision between writes
+// the element had already seen is not recorded again. (must hold lock)
+func (ma *MArrayCRDT[T]) logConflictLocked(elem *Element[T], field ConflictField, a, b ConflictCandidate, winner string, rule ConflictRule) {
+	if ma.config.ConflictLog == nil {
+		return
+	}
+	if elem.VectorClock.Dominates(a.Clock) && elem.VectorClock.Dominates(b.Clock) {
+		return
+	}
+
+	now := time.Now
+	if ma.config.ClockSource != nil {
+		now = ma.config.ClockSource
+	}
+	a.Clock, b.Clock = a.Clock.Clone(), b.Clock.Clone()
+	ma.config.ConflictLog.add(ConflictRecord{
+		Replica:    ma.replicaID,
+		ElementID:  elem.ID,
+		Field:      field,
+		Candidates: [2]ConflictCandidate{a, b},
+		Winner:     winner,
+		Rule:       rule,
+		At:         now(),
+	})
+}
+
+// logValueConflictLocked records how concurrent values were resolved (must hold lock)
+func (ma *MArrayCRDT[T]) logValueConflictLocked(elem *Element[T], local, remote, resolved *VersionedValue[T]) {
+	if ma.config.ConflictLog == nil {
+		return
+	}
+
+	winner := "both"
+	switch {
+	case sameClock(resolved.VectorClock, local.VectorClock):
+		winner = "local"
+	case sameClock(resolved.VectorClock, remote.VectorClock):
+		winner = "remote"
+	}
+	rule := RuleResolver
+	switch {
+	case ma.config.ValueResolver != nil:
+	case ma.config.HybridClock && local.Timestamp != remote.Timestamp:
+		rule = RuleTimestamp
+	default:
+		rule = replicaRule(local.VectorClock, remote.VectorClock)
+	}
+
+	ma.logConflictLocked(elem, FieldValue,
+		ConflictCandidate{"local", local.VectorClock, local.Timestamp},
+		ConflictCandidate{"remote", remote.VectorClock, remote.Timestamp}, winner, rule)
+}
+
+// replicaRule names the rule compareReplicaOrder applies to two clocks
+func replicaRule(a, b *VectorClock) ConflictRule {
+	if a.GetMaxReplica() != b.GetMaxReplica() {
+		return RuleMaxReplica
+	}
+	return RuleClockOrder
+}
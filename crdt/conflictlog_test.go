@@ -0,0 +1,109 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// conflictFields returns the field and winner of every record
+func conflictFields(records []ConflictRecord) map[ConflictField]string {
+	fields := make(map[ConflictField]string, len(records))
+	for _, r := range records {
+		fields[r.Field] = r.Winner
+	}
+	return fields
+}
+
+// TestConflictLogRecordsDecisions tests that value, index and delete races are recorded once
+func TestConflictLogRecordsDecisions(t *testing.T) {
+	log := NewConflictLog(0)
+	replica1 := New[string]("replica1", WithConflictLog(log))
+	replica2 := New[string]("site2", WithConflictLog(log))
+
+	a := replica1.Push("a")
+	b := replica1.Push("b")
+	c := replica1.Push("c")
+	replica2.Merge(replica1)
+
+	replica1.Set(a, "a1")
+	replica2.Set(a, "a2")
+	replica1.Move(b, 0)
+	replica2.Move(b, 2)
+	replica1.Delete(c)
+	replica2.Move(c, 0)
+
+	replica1.Merge(replica2)
+	records := log.Query(func(r ConflictRecord) bool { return r.Replica == "replica1" })
+	expected := map[ConflictField]string{FieldValue: "remote", FieldIndex: "remote", FieldDelete: "remote-move"}
+	if fields := conflictFields(records); len(records) != 3 || !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("Expected %v, got %v", expected, records)
+	}
+	for _, r := range records {
+		if r.Rule != RuleMaxReplica {
+			t.Errorf("%s: expected the max-replica rule, got %s", r.Field, r.Rule)
+		}
+		if r.Candidates[0].Clock == nil || r.Candidates[1].Clock == nil || !r.Candidates[0].Clock.Concurrent(r.Candidates[1].Clock) {
+			t.Errorf("%s: candidates should be concurrent clocks: %v", r.Field, r.Candidates)
+		}
+	}
+	if value := log.ForElement(a); len(value) != 1 || value[0].Candidates[1].Source != "remote" {
+		t.Errorf("Expected one value record for a, got %v", value)
+	}
+
+	// site2 receives only the winners, and known decisions are not repeated
+	replica2.Merge(replica1)
+	replica1.Merge(replica2)
+	replica2.Merge(replica1)
+	if log.Len() != 3 {
+		t.Errorf("Replaying a merge should not add records, got %d", log.Len())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestConflictLogRules tests resolver, multi-value and op-based records and the size limit
+func TestConflictLogRules(t *testing.T) {
+	log := NewConflictLog(2)
+	replica1 := New[int]("replica1", WithConflictLog(log), WithValueResolver(MaxValue[int]()))
+	replica2 := New[int]("site2", WithConflictLog(log), WithValueResolver(MaxValue[int]()))
+	ops := collectOps(replica2)
+
+	id := replica1.Push(0)
+	replica2.Merge(replica1)
+	replica1.Set(id, 7)
+	replica2.Set(id, 3)
+	if err := replica1.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	records := log.Records()
+	if len(records) != 1 || records[0].Rule != RuleResolver || records[0].Winner != "local" {
+		t.Fatalf("Expected a resolver record won by the local value, got %v", records)
+	}
+
+	multi1 := New[string]("replica1", WithConflictLog(log), WithMultiValue())
+	multi2 := New[string]("site2", WithConflictLog(log), WithMultiValue())
+	title := multi1.Push("")
+	multi2.Merge(multi1)
+	for i := 0; i < 2; i++ {
+		multi1.Set(title, "x")
+		multi2.Set(title, "y")
+		multi1.Merge(multi2)
+		multi2.Merge(multi1)
+	}
+
+	records = log.Records()
+	if len(records) != 2 {
+		t.Fatalf("The log should keep only 2 records, got %d", len(records))
+	}
+	for _, r := range records {
+		if r.Rule != RuleSiblings || r.Winner != "both" {
+			t.Errorf("Expected a siblings record, got %v", r)
+		}
+	}
+	log.Clear()
+	if log.Len() != 0 {
+		t.Errorf("Clear left %d records", log.Len())
+	}
+}
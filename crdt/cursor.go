@@ -0,0 +1,173 @@
+package marraycrdt
+
+import "fmt"
+
+// Cursors
+//
+// A Cursor marks a gap in the array by naming the element on one side of it,
+// so it follows that element through remote inserts, deletes and moves
+// instead of keeping a stale index. A cursor whose element was deleted
+// resolves to the gap the tombstone occupies, which is between its nearest
+// live neighbours. Cursors also carry the element's position when they were
+// created; if the element is unknown, for example because its tombstone was
+// compacted or it has not been merged yet, that position locates the gap
+// instead (not for KeepSorted arrays, whose order does not follow positions).
+//
+// Cursors are plain values meant to be broadcast as presence. They encode as
+// JSON and in a small binary form:
+//
+//	{"id": "9f0c...", "side": "before", "position": "V9aZ3kQ11"}
+//
+//	version byte | side byte | id | position
+
+// Side selects which side of its element or character an anchor sticks to
+type Side int
+
+const (
+	// SideBefore keeps the anchor directly before its element
+	SideBefore Side = iota
+	// SideAfter keeps the anchor directly after its element
+	SideAfter
+)
+
+// cursorVersion is the version byte of the binary cursor encoding
+const cursorVersion = 1
+
+// Cursor is a stable reference to a gap between two elements. An empty ID
+// stands for the end of the array (SideBefore) or its start (SideAfter).
+type Cursor struct {
+	ID       string   `json:"id,omitempty"`
+	Side     Side     `json:"side"`
+	Position Position `json:"position,omitempty"`
+}
+
+// CursorAt returns a cursor for the gap before index that sticks to the
+// element after it (SideBefore) or before it (SideAfter)
+func (ma *MArrayCRDT[T]) CursorAt(index int, side Side) Cursor {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return ma.cursorAtLocked(index, side)
+}
+
+// cursorAtLocked implements CursorAt (must hold lock)
+func (ma *MArrayCRDT[T]) cursorAtLocked(index int, side Side) Cursor {
+	order := ma.orderLocked()
+	index = min(max(index, 0), order.len())
+	if side == SideAfter {
+		index--
+	}
+	if elem := order.at(index); elem != nil {
+		return Cursor{ID: elem.ID, Side: side, Position: elem.Index.Position}
+	}
+	return Cursor{Side: side}
+}
+
+// CursorFor returns a cursor on the given side of an element
+func (ma *MArrayCRDT[T]) CursorFor(id string, side Side) (Cursor, bool) {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	elem, ok := ma.items[id]
+	if !ok {
+		return Cursor{}, false
+	}
+	return Cursor{ID: id, Side: side, Position: elem.Index.Position}, true
+}
+
+// ResolveCursor returns the current index of the gap a cursor marks. It fails
+// if the element is unknown and the cursor's position cannot stand in for it.
+func (ma *MArrayCRDT[T]) ResolveCursor(c Cursor) (int, bool) {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return ma.resolveCursorLocked(c)
+}
+
+// resolveCursorLocked implements ResolveCursor (must hold lock)
+func (ma *MArrayCRDT[T]) resolveCursorLocked(c Cursor) (int, bool) {
+	order := ma.orderLocked()
+	if c.ID == "" {
+		if c.Side == SideAfter {
+			return 0, true
+		}
+		return order.len(), true
+	}
+
+	elem, ok := ma.items[c.ID]
+	if !ok {
+		if c.Position == "" || ma.config.KeepSorted {
+			return 0, false
+		}
+		// Stand in a tombstone at the remembered position
+		elem = &Element[T]{
+			ID:      c.ID,
+			Value:   &VersionedValue[T]{},
+			Index:   &VersionedIndex{Position: c.Position},
+			Deleted: true,
+		}
+	}
+
+	index := order.countBefore(elem)
+	if c.Side == SideAfter && !elem.Deleted {
+		index++
+	}
+	return index, true
+}
+
+// MarshalBinary encodes the cursor
+func (c Cursor) MarshalBinary() ([]byte, error) {
+	w := &binWriter{}
+	w.buf = append(w.buf, cursorVersion, byte(c.Side))
+	w.string(c.ID)
+	w.string(string(c.Position))
+	return w.buf, nil
+}
+
+// UnmarshalBinary decodes a cursor produced by MarshalBinary
+func (c *Cursor) UnmarshalBinary(data []byte) error {
+	r := &binReader{data: data}
+	if version := r.byte(); r.err == nil && version != cursorVersion {
+		return fmt.Errorf("%w: unsupported cursor version %d", ErrInvalidEncoding, version)
+	}
+	side := Side(r.byte())
+	id := r.string()
+	position := Position(r.string())
+
+	if r.err != nil {
+		return r.err
+	}
+	if side != SideBefore && side != SideAfter {
+		return fmt.Errorf("%w: bad cursor side %d", ErrInvalidEncoding, side)
+	}
+	if r.pos != len(data) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidEncoding, len(data)-r.pos)
+	}
+
+	*c = Cursor{ID: id, Side: side, Position: position}
+	return nil
+}
+
+// MarshalText encodes the side as "before" or "after"
+func (s Side) MarshalText() ([]byte, error) {
+	switch s {
+	case SideBefore:
+		return []byte("before"), nil
+	case SideAfter:
+		return []byte("after"), nil
+	}
+	return nil, fmt.Errorf("marraycrdt: bad side %d", int(s))
+}
+
+// UnmarshalText decodes "before" or "after"
+func (s *Side) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "before":
+		*s = SideBefore
+	case "after":
+		*s = SideAfter
+	default:
+		return fmt.Errorf("%w: bad side %q", ErrInvalidEncoding, text)
+	}
+	return nil
+}
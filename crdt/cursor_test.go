@@ -0,0 +1,109 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestCursorFollowsRemoteEdits tests cursors across remote inserts and moves
+func TestCursorFollowsRemoteEdits(t *testing.T) {
+	replica1 := newTestChars("replica1", "ABCDE")
+	replica2 := New[string]("site2")
+	replica2.Merge(replica1)
+
+	beforeC := replica1.CursorAt(2, SideBefore)
+	afterB := replica1.CursorAt(2, SideAfter)
+	start := replica1.CursorAt(0, SideAfter)
+	end := replica1.CursorAt(5, SideBefore)
+
+	// Insert into the cursor gap, in front and move C to the end
+	ids := replica2.IDs()
+	replica2.Insert(2, "x")
+	replica2.Unshift("y")
+	replica2.MoveAfter(ids[2], ids[4])
+	replica1.Merge(replica2)
+
+	// y A B x D E C
+	checks := []struct {
+		name     string
+		cursor   Cursor
+		expected int
+	}{
+		{"before C", beforeC, 6},
+		{"after B", afterB, 3},
+		{"start", start, 0},
+		{"end", end, 7},
+	}
+	for _, c := range checks {
+		if index, ok := replica1.ResolveCursor(c.cursor); !ok || index != c.expected {
+			t.Errorf("%s: expected %d, got %d (%v)", c.name, c.expected, index, ok)
+		}
+	}
+}
+
+// TestCursorFallsBackToNeighbour tests cursors whose element was deleted or compacted
+func TestCursorFallsBackToNeighbour(t *testing.T) {
+	replica1 := newTestChars("replica1", "ABCDE")
+	replica1.Join()
+	ids := replica1.IDs()
+
+	cursor, ok := replica1.CursorFor(ids[2], SideAfter)
+	if !ok {
+		t.Fatalf("CursorFor failed")
+	}
+	replica1.Delete(ids[2])
+	replica1.Delete(ids[3])
+	if index, _ := replica1.ResolveCursor(cursor); index != 2 {
+		t.Errorf("Expected deleted cursor at 2, got %d", index)
+	}
+
+	// The remembered position still works once the tombstone is gone
+	if replica1.Compact() != 2 {
+		t.Fatalf("Expected both tombstones to be compacted")
+	}
+	if index, ok := replica1.ResolveCursor(cursor); !ok || index != 2 {
+		t.Errorf("Expected compacted cursor at 2, got %d (%v)", index, ok)
+	}
+	if _, ok := replica1.ResolveCursor(Cursor{ID: "unknown"}); ok {
+		t.Errorf("Cursor without element or position should not resolve")
+	}
+}
+
+// TestCursorEncoding tests the JSON and binary forms of a cursor
+func TestCursorEncoding(t *testing.T) {
+	replica1 := newTestChars("replica1", "ABC")
+	cursor := replica1.CursorAt(1, SideAfter)
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	var fromJSON Cursor
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, cursor) {
+		t.Errorf("JSON round trip changed cursor: %+v vs %+v", fromJSON, cursor)
+	}
+
+	data, err = cursor.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var fromBinary Cursor
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if !reflect.DeepEqual(fromBinary, cursor) {
+		t.Errorf("Binary round trip changed cursor: %+v vs %+v", fromBinary, cursor)
+	}
+
+	if err := fromBinary.UnmarshalBinary(data[:len(data)-1]); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected ErrInvalidEncoding for truncated cursor, got %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"side":"left"}`), &fromJSON); err == nil {
+		t.Errorf("Expected an error for an unknown side")
+	}
+}
@@ -0,0 +1,68 @@
+package marraycrdt
+
+// Dominates returns true if this clock has seen every event in other,
+// i.e. each entry is greater than or equal to the matching entry of other
+func (vc *VectorClock) Dominates(other *VectorClock) bool {
+	if other == nil {
+		return true
+	}
+	if vc == nil {
+		return len(other.toMap()) == 0
+	}
+
+	vc.mu.RLock()
+	other.mu.RLock()
+	defer vc.mu.RUnlock()
+	defer other.mu.RUnlock()
+
+	return dominatesLocked(vc, other)
+}
+
+// Clock returns a copy of the replica clock. Peers send it to DeltaSince to
+// describe what they have already seen.
+func (ma *MArrayCRDT[T]) Clock() *VectorClock {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return ma.clock.Clone()
+}
+
+// DeltaSince returns a partial replica holding only the elements and marks
+// that changed after vc, that is every one whose clock is not dominated by vc.
+// Tombstones are included so deletes propagate, and the membership table is
+// always included in full. A nil clock yields a full copy. The result is
+// meant to be shipped to the peer that owns vc and folded in with MergeDelta.
+func (ma *MArrayCRDT[T]) DeltaSince(vc *VectorClock) *MArrayCRDT[T] {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	delta := &MArrayCRDT[T]{
+		items:     make(map[string]*Element[T]),
+		replicaID: ma.replicaID,
+		clock:     ma.clock.Clone(),
+		config:    ma.config,
+	}
+
+	for id, elem := range ma.items {
+		if vc != nil && vc.Dominates(elem.VectorClock) {
+			continue
+		}
+		delta.items[id] = forkElement(elem, ma.replicaID)
+	}
+	for _, mark := range ma.marks {
+		if vc == nil || !vc.Dominates(mark.Clock) {
+			delta.mergeMarksLocked(map[string]*Mark{mark.ID: mark})
+		}
+	}
+
+	delta.mergeMembersLocked(ma.members)
+
+	delta.rebuildOrderLocked()
+	return delta
+}
+
+// MergeDelta folds a delta produced by DeltaSince into this replica using the
+// same LWW rules as Merge. Elements missing from the delta are left untouched.
+func (ma *MArrayCRDT[T]) MergeDelta(delta *MArrayCRDT[T]) {
+	ma.Merge(delta)
+}
@@ -0,0 +1,135 @@
+package marraycrdt
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// TestDeltaSinceOnlyCarriesChanges tests that a delta holds just the elements the peer is missing
+func TestDeltaSinceOnlyCarriesChanges(t *testing.T) {
+	replica1 := New[int]("replica1")
+	replica2 := New[int]("site2")
+
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = replica1.Push(i)
+	}
+	replica2.Merge(replica1)
+
+	// One edit, one move and one delete after the sync
+	replica1.Set(ids[10], 1000)
+	replica1.Move(ids[20], 0)
+	replica1.Delete(ids[30])
+
+	delta := replica1.DeltaSince(replica2.Clock())
+	if len(delta.items) != 3 {
+		t.Fatalf("Expected delta with 3 elements, got %d", len(delta.items))
+	}
+	for _, id := range []string{ids[10], ids[20], ids[30]} {
+		if _, ok := delta.items[id]; !ok {
+			t.Errorf("Delta is missing changed element %s", id)
+		}
+	}
+
+	replica2.MergeDelta(delta)
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge!\nReplica1: %v\nReplica2: %v",
+			replica1.ToSlice(), replica2.ToSlice())
+	}
+
+	// Nothing left to send
+	if delta := replica1.DeltaSince(replica2.Clock()); len(delta.items) != 0 {
+		t.Errorf("Expected empty delta after sync, got %d elements", len(delta.items))
+	}
+}
+
+// TestDeltaExchangeConcurrent tests a two-way delta exchange with concurrent edits
+func TestDeltaExchangeConcurrent(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	_ = replica1.Push("A")
+	idB := replica1.Push("B")
+	idC := replica1.Push("C")
+	replica2.Merge(replica1)
+
+	replica1.Set(idB, "B1")
+	replica1.Push("D")
+	replica2.Set(idB, "B2")
+	replica2.Move(idC, 0)
+
+	// Exchange clocks, then pull just what is missing
+	clock1 := replica1.Clock()
+	clock2 := replica2.Clock()
+	delta1 := replica1.DeltaSince(clock2)
+	delta2 := replica2.DeltaSince(clock1)
+	replica1.MergeDelta(delta2)
+	replica2.MergeDelta(delta1)
+
+	// Deltas must give the same result as full state merges
+	full1 := replica1.Clone()
+	full1.Merge(replica2)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge!\nReplica1: %v\nReplica2: %v",
+			replica1.ToSlice(), replica2.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), full1.ToSlice()) {
+		t.Errorf("Delta merge differs from full merge: %v vs %v",
+			replica1.ToSlice(), full1.ToSlice())
+	}
+}
+
+// TestDeltaSinceNilClock tests that a nil clock produces a full copy
+func TestDeltaSinceNilClock(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica1.Push("A")
+	id := replica1.Push("B")
+	replica1.Delete(id)
+
+	delta := replica1.DeltaSince(nil)
+	if len(delta.items) != 2 {
+		t.Errorf("Expected 2 elements including tombstone, got %d", len(delta.items))
+	}
+}
+
+// TestRandomDeltaSyncConverges tests that random pairwise delta exchanges
+// between replicas editing concurrently reach the state of a full merge
+func TestRandomDeltaSyncConverges(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		replicas := []*MArrayCRDT[string]{New[string]("a"), New[string]("b"), New[string]("c")}
+
+		for round := 0; round < 10; round++ {
+			for _, r := range replicas {
+				for range rng.Intn(4) {
+					randomEdit(rng, r)
+				}
+			}
+			to, from := replicas[rng.Intn(len(replicas))], replicas[rng.Intn(len(replicas))]
+			to.MergeDelta(from.DeltaSince(to.Clock()))
+		}
+
+		// Finish with a full round of deltas in a random order
+		for _, i := range rng.Perm(len(replicas) * len(replicas)) {
+			to, from := replicas[i/len(replicas)], replicas[i%len(replicas)]
+			to.MergeDelta(from.DeltaSince(to.Clock()))
+		}
+		for _, to := range replicas {
+			for _, from := range replicas {
+				to.MergeDelta(from.DeltaSince(to.Clock()))
+			}
+		}
+
+		merged := New[string]("merged")
+		for _, r := range replicas {
+			merged.Merge(r)
+		}
+		for _, r := range replicas {
+			if !reflect.DeepEqual(r.ToSlice(), merged.ToSlice()) {
+				t.Fatalf("seed %d: %s has %v, merge has %v", seed, r.replicaID, r.ToSlice(), merged.ToSlice())
+			}
+		}
+	}
+}
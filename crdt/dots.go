@@ -0,0 +1,176 @@
+package marraycrdt
+
+// Compact clocks
+//
+// Every element carries a value, an index, an element and possibly a delete
+// clock, and each of them used to be a private copy of the replica clock.
+// A write only adds one event to what its replica had already seen, so a
+// clock is stored as a causal context shared with every clock forked from
+// the same replica state, plus a single (replica, counter) dot for the event
+// on top of it. Fork shares the context instead of copying it, and a Merge
+// into a clock the other side dominates adopts the other context outright.
+// The context is only copied when a clock changes in a way its dot cannot
+// express, and never modified once it is shared. Clone still returns a
+// private copy. Clocks of applied operations and decoded elements are
+// rebuilt around shared contexts as well, see contextCache.
+//
+// Clocks keep their full meaning: every entry, comparison and encoding is
+// the same as for a plain map, so merges decide exactly as before.
+
+// dot is a single event: a replica and its counter at that event
+type dot struct {
+	replica string
+	counter uint64
+}
+
+// getLocked returns the counter of a replica (must hold lock)
+func (vc *VectorClock) getLocked(replica string) uint64 {
+	clock := vc.clocks[replica]
+	if vc.dot.replica == replica && vc.dot.counter > clock {
+		clock = vc.dot.counter
+	}
+	return clock
+}
+
+// eachLocked calls fn for every entry of the clock (must hold lock)
+func (vc *VectorClock) eachLocked(fn func(replica string, clock uint64)) {
+	for replica, clock := range vc.clocks {
+		if vc.dot.replica == replica && vc.dot.counter > clock {
+			clock = vc.dot.counter
+		}
+		fn(replica, clock)
+	}
+	if vc.dot.counter > 0 {
+		if _, ok := vc.clocks[vc.dot.replica]; !ok {
+			fn(vc.dot.replica, vc.dot.counter)
+		}
+	}
+}
+
+// lenLocked returns the number of entries (must hold lock)
+func (vc *VectorClock) lenLocked() int {
+	n := len(vc.clocks)
+	if vc.dot.counter > 0 {
+		if _, ok := vc.clocks[vc.dot.replica]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// flattenLocked folds the dot into a context only this clock holds, so the
+// context can be changed in place (must hold lock)
+func (vc *VectorClock) flattenLocked() {
+	if !vc.owned.Load() {
+		clocks := make(map[string]uint64, vc.lenLocked())
+		for replica, clock := range vc.clocks {
+			clocks[replica] = clock
+		}
+		vc.clocks = clocks
+		vc.owned.Store(true)
+	}
+	if vc.dot.counter > vc.clocks[vc.dot.replica] {
+		vc.clocks[vc.dot.replica] = vc.dot.counter
+	}
+	vc.dot = dot{}
+}
+
+// shareLocked makes the clock equal to other by sharing its context. Neither
+// clock may change the context in place afterwards. (must hold both locks)
+func (vc *VectorClock) shareLocked(other *VectorClock) {
+	other.owned.Store(false)
+	vc.owned.Store(false)
+	vc.clocks = other.clocks
+	vc.dot = other.dot
+}
+
+// dominatesLocked reports whether a has seen every event of b (must hold both locks)
+func dominatesLocked(a, b *VectorClock) bool {
+	dominates := true
+	b.eachLocked(func(replica string, clock uint64) {
+		if dominates && a.getLocked(replica) < clock {
+			dominates = false
+		}
+	})
+	return dominates
+}
+
+// contextCache hands out shared contexts for clocks built from plain
+// entries, such as operation and decoded clocks. Events of one writer
+// between two of its merges differ only in the writer's own entry, so they
+// all reuse the context cached for that writer.
+type contextCache map[string]map[string]uint64
+
+// clock returns a clock equal to entries, written by writer
+func (c contextCache) clock(entries map[string]uint64, writer string) *VectorClock {
+	if vc := c.lookup(entries, writer); vc != nil {
+		return vc
+	}
+
+	context := make(map[string]uint64, len(entries))
+	for replica, clock := range entries {
+		if replica != writer {
+			context[replica] = clock
+		}
+	}
+	c[writer] = context
+	return &VectorClock{clocks: context, dot: dot{writer, entries[writer]}}
+}
+
+// lookup returns a clock equal to entries if the cached context of writer
+// fits them, or nil
+func (c contextCache) lookup(entries map[string]uint64, writer string) *VectorClock {
+	context, ok := c[writer]
+	if !ok || !sameContext(context, entries, writer) {
+		return nil
+	}
+	return &VectorClock{clocks: context, dot: dot{writer, entries[writer]}}
+}
+
+// sameContext reports whether entries match context everywhere but writer
+func sameContext(context, entries map[string]uint64, writer string) bool {
+	n := len(entries)
+	if _, ok := entries[writer]; ok {
+		n--
+	}
+	if len(context) != n {
+		return false
+	}
+	for replica, clock := range context {
+		if counter, ok := entries[replica]; !ok || counter != clock {
+			return false
+		}
+	}
+	return true
+}
+
+// shareClocksLocked rebuilds decoded element clocks around shared contexts.
+// Decoding does not say who wrote an index, element or delete clock, so they
+// are attributed to the value's writer. They reuse a value context when it
+// fits and otherwise get a cache per kind of clock, so a wrong guess does not
+// evict the contexts of the values. (must hold lock)
+func (ma *MArrayCRDT[T]) shareClocksLocked() {
+	var caches [4]contextCache
+	for i := range caches {
+		caches[i] = make(contextCache)
+	}
+
+	for _, elem := range ma.items {
+		value := elem.Value
+		value.VectorClock = caches[0].clock(value.VectorClock.toMap(), value.Writer)
+		for _, sibling := range value.Siblings {
+			sibling.VectorClock = caches[0].clock(sibling.VectorClock.toMap(), sibling.Writer)
+		}
+		for i, vc := range []**VectorClock{&elem.Index.VectorClock, &elem.VectorClock, &elem.DeleteClock} {
+			if *vc == nil {
+				continue
+			}
+			entries := (*vc).toMap()
+			if shared := caches[0].lookup(entries, value.Writer); shared != nil {
+				*vc = shared
+			} else {
+				*vc = caches[i+1].clock(entries, value.Writer)
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// heapAlloc returns the live heap after a collection
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// TestCompactClocksMatchPlainClocks tests compact clocks against plain maps under random updates
+func TestCompactClocksMatchPlainClocks(t *testing.T) {
+	r := mathrand.New(mathrand.NewSource(1))
+	replicas := []string{"replica1", "site2", "site3", "site4"}
+
+	clocks := []*VectorClock{NewVectorClock()}
+	plain := []map[string]uint64{{}}
+	for step := 0; step < 2000; step++ {
+		i := r.Intn(len(clocks))
+		switch r.Intn(4) {
+		case 0:
+			replica := replicas[r.Intn(len(replicas))]
+			clocks[i].Increment(replica)
+			plain[i][replica]++
+		case 1:
+			j := r.Intn(len(clocks))
+			if i == j {
+				continue
+			}
+			clocks[i].Merge(clocks[j])
+			for replica, counter := range plain[j] {
+				plain[i][replica] = max(plain[i][replica], counter)
+			}
+		default:
+			copied := clocks[i].Fork()
+			if r.Intn(2) == 0 {
+				copied = clocks[i].Clone()
+			}
+			clocks = append(clocks, copied)
+			entries := make(map[string]uint64, len(plain[i]))
+			for replica, counter := range plain[i] {
+				entries[replica] = counter
+			}
+			plain = append(plain, entries)
+		}
+
+		j := r.Intn(len(clocks))
+		if got := clocks[i].toMap(); !reflect.DeepEqual(got, plain[i]) {
+			t.Fatalf("Step %d: expected %v, got %v", step, plain[i], got)
+		}
+		if got, want := clocks[i].Dominates(clocks[j]), dominatesPlain(plain[i], plain[j]); got != want {
+			t.Fatalf("Step %d: Dominates(%v, %v) = %v", step, plain[i], plain[j], got)
+		}
+		if got, want := clocks[i].After(clocks[j]), dominatesPlain(plain[i], plain[j]) && !dominatesPlain(plain[j], plain[i]); got != want {
+			t.Fatalf("Step %d: After(%v, %v) = %v", step, plain[i], plain[j], got)
+		}
+	}
+}
+
+// dominatesPlain is Dominates for plain clock entries
+func dominatesPlain(a, b map[string]uint64) bool {
+	for replica, counter := range b {
+		if a[replica] < counter {
+			return false
+		}
+	}
+	return true
+}
+
+// TestElementClocksShareContext tests that element clocks reuse the replica's context after writes, merges, ops and decoding
+func TestElementClocksShareContext(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	replica3 := New[string]("site3")
+	ops := collectOps(replica1)
+	syncAll(replica1, replica2, replica3)
+
+	for i := 0; i < 3; i++ {
+		id := replica1.Push(fmt.Sprint(i))
+		replica1.Set(id, fmt.Sprint(-i))
+	}
+	replica2.Merge(replica1)
+	if err := replica3.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	data, err := replica1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	decoded := New[string]("other")
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+
+	data, err = json.Marshal(replica1)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	fromJSON := New[string]("other")
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2, replica3, decoded, fromJSON} {
+		contexts := make(map[uintptr]bool)
+		for _, elem := range r.items {
+			for _, vc := range []*VectorClock{elem.Value.VectorClock, elem.Index.VectorClock, elem.VectorClock} {
+				contexts[reflect.ValueOf(vc.clocks).Pointer()] = true
+			}
+		}
+		if len(contexts) > 1 {
+			t.Errorf("%s: expected one shared context, got %d", r.replicaID, len(contexts))
+		}
+		if !reflect.DeepEqual(r.ToSlice(), replica1.ToSlice()) {
+			t.Errorf("Replicas did not converge! R1: %v, %s: %v", replica1.ToSlice(), r.replicaID, r.ToSlice())
+		}
+	}
+}
+
+// plainClock is the clock representation that dots replaced: every clock
+// holds a private copy of all entries
+type plainClock struct {
+	mu     sync.RWMutex
+	clocks map[string]uint64
+}
+
+// fork returns a private copy, as Fork did before dots
+func (vc *plainClock) fork() *plainClock {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	clocks := make(map[string]uint64, len(vc.clocks))
+	for replica, counter := range vc.clocks {
+		clocks[replica] = counter
+	}
+	return &plainClock{clocks: clocks}
+}
+
+// plainElement is an Element whose clocks are plain copies
+type plainElement struct {
+	ID    string
+	Value struct {
+		Data        int
+		VectorClock *plainClock
+		Timestamp   Timestamp
+		Writer      string
+	}
+	Index struct {
+		Position    Position
+		VectorClock *plainClock
+		Timestamp   Timestamp
+	}
+	VectorClock *plainClock
+}
+
+// writePlain builds elements the way Push followed by Set did before dots:
+// each field clock is a fork of the replica clock plus the new event
+func writePlain(clock *plainClock, replicaID string, elements int) map[string]*plainElement {
+	items := make(map[string]*plainElement)
+	for j := 0; j < elements; j++ {
+		elem := &plainElement{ID: generateUUID()}
+		clock.clocks[replicaID]++
+		elem.Value.Data = j
+		elem.Value.VectorClock = clock.fork()
+		elem.Value.Writer = replicaID
+		elem.Index.Position = Position(fmt.Sprint(j))
+		elem.Index.VectorClock = clock.fork()
+		elem.VectorClock = clock.fork()
+		items[elem.ID] = elem
+
+		clock.clocks[replicaID]++
+		elem.Value.Data = -j
+		elem.Value.VectorClock = clock.fork()
+		elem.VectorClock.clocks[replicaID] = clock.clocks[replicaID]
+	}
+	return items
+}
+
+// BenchmarkBytesPerElement measures the heap held per element by replicas
+// that know many other replicas: for elements written locally, received by
+// Merge, received as operations and decoded from the binary encoding. The
+// baseline metric holds the same writes in plainElement fixtures, the
+// representation before dots.
+func BenchmarkBytesPerElement(b *testing.B) {
+	const elements = 1000
+
+	for _, replicas := range []int{1, 10, 100, 500} {
+		b.Run(fmt.Sprintf("replicas=%d", replicas), func(b *testing.B) {
+			seed := New[int]("replica1")
+			for i := 2; i <= replicas; i++ {
+				peer := New[int](fmt.Sprintf("site%d", i))
+				peer.Push(i)
+				seed.Merge(peer)
+			}
+
+			var baseline, written, merged, applied, decoded float64
+			for i := 0; i < b.N; i++ {
+				plain := &plainClock{clocks: seed.Clock().toMap()}
+				beforePlain := heapAlloc()
+				fixtures := writePlain(plain, "replica1", elements)
+				afterPlain := heapAlloc()
+				baseline += float64(afterPlain-beforePlain) / elements
+				runtime.KeepAlive(fixtures)
+
+				write := func(ma *MArrayCRDT[int]) {
+					for j := 0; j < elements; j++ {
+						id := ma.Push(j)
+						ma.Set(id, -j)
+					}
+				}
+				local := seed.Clone()
+				remote := seed.Fork(fmt.Sprintf("site%d", replicas+1))
+				receiver := seed.Fork(fmt.Sprintf("site%d", replicas+2))
+				sender := seed.Fork(fmt.Sprintf("site%d", replicas+3))
+				ops := collectOps(sender)
+				write(sender)
+
+				start := heapAlloc()
+				write(local)
+				afterWrites := heapAlloc()
+				remote.Merge(local)
+				afterMerge := heapAlloc()
+				if err := receiver.Apply(*ops...); err != nil {
+					b.Fatalf("Apply failed: %v", err)
+				}
+				afterApply := heapAlloc()
+
+				data, err := local.MarshalBinary()
+				if err != nil {
+					b.Fatalf("MarshalBinary failed: %v", err)
+				}
+				*ops = nil
+				beforeDecode := heapAlloc()
+				fromBinary := New[int]("other")
+				if err := fromBinary.UnmarshalBinary(data); err != nil {
+					b.Fatalf("UnmarshalBinary failed: %v", err)
+				}
+				afterDecode := heapAlloc()
+
+				written += float64(afterWrites-start) / elements
+				merged += float64(afterMerge-afterWrites) / elements
+				applied += float64(afterApply-afterMerge) / elements
+				decoded += float64(afterDecode-beforeDecode) / elements
+				runtime.KeepAlive(local)
+				runtime.KeepAlive(remote)
+				runtime.KeepAlive(receiver)
+				runtime.KeepAlive(data)
+				runtime.KeepAlive(fromBinary)
+			}
+			b.ReportMetric(baseline/float64(b.N), "B/baseline-elem")
+			b.ReportMetric(written/float64(b.N), "B/written-elem")
+			b.ReportMetric(merged/float64(b.N), "B/merged-elem")
+			b.ReportMetric(applied/float64(b.N), "B/applied-elem")
+			b.ReportMetric(decoded/float64(b.N), "B/decoded-elem")
+		})
+	}
+}
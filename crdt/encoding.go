@@ -0,0 +1,638 @@
+package marraycrdt
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Binary format
+//
+// A replica is encoded as
+//
+//	magic "MACR" | version byte
+//	replicaID
+//	replica table: count, names...            (sorted, referenced by clocks)
+//	replica clock
+//	element count, elements...                (sorted by ID)
+//	member count, members...                  (sorted by replica ID)
+//	mark count, marks...                      (sorted by ID)
+//
+// where a value is
+//
+//	value bytes | clock | timestamp (wall, logical) | writer (table index + 1, 0 if unknown)
+//
+// and every element is
+//
+//	id | flags (bit 0 deleted, bit 1 has delete clock)
+//	value | sibling count, siblings...
+//	position | index clock | index timestamp
+//	element clock | [delete clock | delete timestamp]
+//
+// and every membership entry is
+//
+//	replica ID | active (0 or 1) | membership clock
+//
+// and every mark is
+//
+//	id | key | value (JSON) | start | end | expand | clock
+//
+// Integers are unsigned varints, strings and byte slices are length
+// prefixed, and a vector clock is a count followed by (replica table index,
+// counter) pairs. Decoders accept exactly the version they write; a format
+// change bumps the version. Local settings such as Config and operation
+// handlers are not part of the encoding.
+const (
+	binaryMagic   = "MACR"
+	binaryVersion = 1
+
+	flagDeleted     = 1 << 0
+	flagDeleteClock = 1 << 1
+)
+
+// ErrInvalidEncoding is returned when decoding malformed or unsupported data
+var ErrInvalidEncoding = errors.New("marraycrdt: invalid encoding")
+
+// ValueCodec converts element values to and from bytes for MarshalBinary
+type ValueCodec[T any] interface {
+	EncodeValue(value T) ([]byte, error)
+	DecodeValue(data []byte) (T, error)
+}
+
+// WithValueCodec sets the codec used to serialize element values
+func WithValueCodec[T any](codec ValueCodec[T]) Option {
+	return func(c *Config) {
+		c.ValueCodec = codec
+	}
+}
+
+// DefaultCodec encodes strings, byte slices, booleans and integer/float types
+// directly, uses encoding.BinaryMarshaler when T implements it and falls back
+// to gob for everything else. Nil pointers cannot be encoded.
+type DefaultCodec[T any] struct{}
+
+// EncodeValue implements ValueCodec
+func (DefaultCodec[T]) EncodeValue(value T) ([]byte, error) {
+	switch v := any(value).(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return append([]byte(nil), v...), nil
+	case bool:
+		if v {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case int:
+		return binary.AppendVarint(nil, int64(v)), nil
+	case int64:
+		return binary.AppendVarint(nil, v), nil
+	case int32:
+		return binary.AppendVarint(nil, int64(v)), nil
+	case uint:
+		return binary.AppendUvarint(nil, uint64(v)), nil
+	case uint64:
+		return binary.AppendUvarint(nil, v), nil
+	case uint32:
+		return binary.AppendUvarint(nil, uint64(v)), nil
+	case float64:
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)), nil
+	case encoding.BinaryMarshaler:
+		// A nil pointer would panic in MarshalBinary and has no encoding
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil, fmt.Errorf("%w: nil %T value", ErrInvalidEncoding, value)
+		}
+		return v.MarshalBinary()
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeValue implements ValueCodec
+func (DefaultCodec[T]) DecodeValue(data []byte) (T, error) {
+	var value T
+
+	switch v := any(&value).(type) {
+	case *string:
+		*v = string(data)
+		return value, nil
+	case *[]byte:
+		*v = append([]byte(nil), data...)
+		return value, nil
+	case *bool:
+		if len(data) != 1 {
+			return value, fmt.Errorf("%w: bad bool value", ErrInvalidEncoding)
+		}
+		*v = data[0] != 0
+		return value, nil
+	case *int, *int64, *int32:
+		n, size := binary.Varint(data)
+		if size <= 0 {
+			return value, fmt.Errorf("%w: bad integer value", ErrInvalidEncoding)
+		}
+		switch p := v.(type) {
+		case *int:
+			*p = int(n)
+		case *int64:
+			*p = n
+		case *int32:
+			*p = int32(n)
+		}
+		return value, nil
+	case *uint, *uint64, *uint32:
+		n, size := binary.Uvarint(data)
+		if size <= 0 {
+			return value, fmt.Errorf("%w: bad integer value", ErrInvalidEncoding)
+		}
+		switch p := v.(type) {
+		case *uint:
+			*p = uint(n)
+		case *uint64:
+			*p = n
+		case *uint32:
+			*p = uint32(n)
+		}
+		return value, nil
+	case *float64:
+		if len(data) != 8 {
+			return value, fmt.Errorf("%w: bad float value", ErrInvalidEncoding)
+		}
+		*v = math.Float64frombits(binary.LittleEndian.Uint64(data))
+		return value, nil
+	case encoding.BinaryUnmarshaler:
+		err := v.UnmarshalBinary(data)
+		return value, err
+	}
+
+	// Pointer types such as *MArrayCRDT[V] need a fresh target to decode into
+	if rt := reflect.TypeFor[T](); rt.Kind() == reflect.Pointer {
+		if u, ok := reflect.New(rt.Elem()).Interface().(encoding.BinaryUnmarshaler); ok {
+			err := u.UnmarshalBinary(data)
+			return u.(T), err
+		}
+	}
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// valueCodec returns the configured codec or the default one
+func (ma *MArrayCRDT[T]) valueCodec() ValueCodec[T] {
+	if codec, ok := ma.config.ValueCodec.(ValueCodec[T]); ok {
+		return codec
+	}
+	return DefaultCodec[T]{}
+}
+
+// MarshalBinary encodes the full replica state, including tombstones and
+// every per-field clock, in a compact versioned format
+func (ma *MArrayCRDT[T]) MarshalBinary() ([]byte, error) {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	codec := ma.valueCodec()
+
+	ids := make([]string, 0, len(ma.items))
+	for id := range ma.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Build the replica table from every clock in the replica
+	table := newReplicaTable()
+	table.addClock(ma.clock)
+	for _, id := range ids {
+		elem := ma.items[id]
+		for _, v := range append([]*VersionedValue[T]{elem.Value}, elem.Value.Siblings...) {
+			table.addClock(v.VectorClock)
+			table.addName(v.Writer)
+		}
+		table.addClock(elem.Index.VectorClock)
+		table.addClock(elem.VectorClock)
+		table.addClock(elem.DeleteClock)
+	}
+	members := ma.sortedMembersLocked()
+	for _, replica := range members {
+		table.addClock(ma.members[replica].Clock)
+	}
+	marks := ma.sortedMarkIDsLocked()
+	for _, id := range marks {
+		table.addClock(ma.marks[id].Clock)
+	}
+	table.seal()
+
+	w := &binWriter{}
+	w.buf = append(w.buf, binaryMagic...)
+	w.buf = append(w.buf, binaryVersion)
+	w.string(ma.replicaID)
+
+	w.uvarint(uint64(len(table.names)))
+	for _, name := range table.names {
+		w.string(name)
+	}
+	w.clock(table, ma.clock)
+
+	w.uvarint(uint64(len(ids)))
+	for _, id := range ids {
+		elem := ma.items[id]
+
+		var flags byte
+		if elem.Deleted {
+			flags |= flagDeleted
+		}
+		if elem.DeleteClock != nil {
+			flags |= flagDeleteClock
+		}
+
+		w.string(id)
+		w.buf = append(w.buf, flags)
+		if err := writeValue(w, table, codec, elem.Value); err != nil {
+			return nil, fmt.Errorf("marraycrdt: encode value of %s: %w", id, err)
+		}
+		w.uvarint(uint64(len(elem.Value.Siblings)))
+		for _, sibling := range elem.Value.Siblings {
+			if err := writeValue(w, table, codec, sibling); err != nil {
+				return nil, fmt.Errorf("marraycrdt: encode value of %s: %w", id, err)
+			}
+		}
+		w.string(string(elem.Index.Position))
+		w.clock(table, elem.Index.VectorClock)
+		w.timestamp(elem.Index.Timestamp)
+		w.clock(table, elem.VectorClock)
+		if elem.DeleteClock != nil {
+			w.clock(table, elem.DeleteClock)
+			w.timestamp(elem.DeleteTime)
+		}
+	}
+
+	w.uvarint(uint64(len(members)))
+	for _, replica := range members {
+		m := ma.members[replica]
+		w.string(replica)
+		if m.Active {
+			w.buf = append(w.buf, 1)
+		} else {
+			w.buf = append(w.buf, 0)
+		}
+		w.clock(table, m.Clock)
+	}
+
+	w.uvarint(uint64(len(marks)))
+	for _, id := range marks {
+		mark := ma.marks[id]
+		value, err := json.Marshal(mark.Value)
+		if err != nil {
+			return nil, fmt.Errorf("marraycrdt: encode value of mark %s: %w", id, err)
+		}
+		w.string(id)
+		w.string(mark.Key)
+		w.bytes(value)
+		w.string(mark.Start)
+		w.string(mark.End)
+		w.uvarint(uint64(mark.Expand))
+		w.clock(table, mark.Clock)
+	}
+
+	return w.buf, nil
+}
+
+// UnmarshalBinary replaces the replica state with data produced by
+// MarshalBinary. The replica ID is restored from the encoding; configuration
+// and registered handlers are kept.
+func (ma *MArrayCRDT[T]) UnmarshalBinary(data []byte) error {
+	r := &binReader{data: data}
+
+	if len(data) < len(binaryMagic)+1 || string(data[:len(binaryMagic)]) != binaryMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidEncoding)
+	}
+	r.pos = len(binaryMagic)
+	if version := r.byte(); version != binaryVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidEncoding, version)
+	}
+
+	replicaID := r.string()
+
+	names := make([]string, r.count())
+	for i := range names {
+		names[i] = r.string()
+	}
+	clock := r.clock(names)
+
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	codec := ma.valueCodec()
+
+	count := r.count()
+	items := make(map[string]*Element[T], count)
+	for i := 0; i < count && r.err == nil; i++ {
+		id := r.string()
+		flags := r.byte()
+		value, err := readValue(r, names, codec)
+		if err != nil {
+			return fmt.Errorf("marraycrdt: decode value of %s: %w", id, err)
+		}
+		siblings := r.count()
+		for j := 0; j < siblings && r.err == nil; j++ {
+			sibling, err := readValue(r, names, codec)
+			if err != nil {
+				return fmt.Errorf("marraycrdt: decode value of %s: %w", id, err)
+			}
+			value.Siblings = append(value.Siblings, sibling)
+		}
+		position := Position(r.string())
+		indexClock := r.clock(names)
+		indexTime := r.timestamp()
+		elemClock := r.clock(names)
+
+		var deleteClock *VectorClock
+		var deleteTime Timestamp
+		if flags&flagDeleteClock != 0 {
+			deleteClock = r.clock(names)
+			deleteTime = r.timestamp()
+		}
+		if r.err != nil {
+			break
+		}
+
+		items[id] = &Element[T]{
+			ID:          id,
+			Value:       value,
+			Index:       &VersionedIndex{Position: position, VectorClock: indexClock, Timestamp: indexTime},
+			VectorClock: elemClock,
+			Deleted:     flags&flagDeleted != 0,
+			DeleteClock: deleteClock,
+			DeleteTime:  deleteTime,
+		}
+	}
+
+	count = r.count()
+	members := make(map[string]*member, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		replica := r.string()
+		active := r.byte()
+		members[replica] = &member{Active: active != 0, Clock: r.clock(names)}
+	}
+
+	count = r.count()
+	marks := make(map[string]*Mark, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		mark := &Mark{ID: r.string(), Key: r.string()}
+		value := r.bytes()
+		mark.Start = r.string()
+		mark.End = r.string()
+		mark.Expand = MarkExpand(r.uvarint())
+		mark.Clock = r.clock(names)
+		if r.err != nil {
+			break
+		}
+		if err := json.Unmarshal(value, &mark.Value); err != nil {
+			return fmt.Errorf("marraycrdt: decode value of mark %s: %w", mark.ID, err)
+		}
+		marks[mark.ID] = mark
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos != len(data) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidEncoding, len(data)-r.pos)
+	}
+
+	if ma.items == nil {
+		ma.config = defaultConfig()
+	}
+	ma.replicaID = replicaID
+	ma.clock = clock
+	ma.items = items
+	for _, elem := range items {
+		ma.observeElementTimeLocked(elem)
+	}
+	ma.pendingOps = nil
+	ma.gcBarrier, ma.gcHorizon = nil, nil
+	ma.members, ma.memberClock = nil, nil
+	ma.mergeMembersLocked(members)
+	ma.marks = marks
+	ma.shareClocksLocked()
+	ma.rebuildOrderLocked()
+
+	return nil
+}
+
+// writeValue encodes one value with its clock, timestamp and writer
+func writeValue[T any](w *binWriter, table *replicaTable, codec ValueCodec[T], v *VersionedValue[T]) error {
+	data, err := codec.EncodeValue(v.Data)
+	if err != nil {
+		return err
+	}
+	w.bytes(data)
+	w.clock(table, v.VectorClock)
+	w.timestamp(v.Timestamp)
+	if v.Writer == "" {
+		w.uvarint(0)
+	} else {
+		w.uvarint(table.index[v.Writer] + 1)
+	}
+	return nil
+}
+
+// readValue decodes a value written by writeValue
+func readValue[T any](r *binReader, names []string, codec ValueCodec[T]) (*VersionedValue[T], error) {
+	raw := r.bytes()
+	v := &VersionedValue[T]{VectorClock: r.clock(names), Timestamp: r.timestamp()}
+	if writer := r.uvarint(); writer > uint64(len(names)) {
+		if r.err == nil {
+			r.err = fmt.Errorf("%w: writer index %d out of range", ErrInvalidEncoding, writer-1)
+		}
+	} else if writer > 0 {
+		v.Writer = names[writer-1]
+	}
+	if r.err != nil {
+		return v, nil
+	}
+
+	data, err := codec.DecodeValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	v.Data = data
+	return v, nil
+}
+
+// replicaTable maps replica names to compact indices
+type replicaTable struct {
+	names []string
+	index map[string]uint64
+}
+
+func newReplicaTable() *replicaTable {
+	return &replicaTable{index: make(map[string]uint64)}
+}
+
+func (t *replicaTable) addClock(vc *VectorClock) {
+	if vc == nil {
+		return
+	}
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	vc.eachLocked(func(replica string, _ uint64) {
+		if _, ok := t.index[replica]; !ok {
+			t.index[replica] = 0
+			t.names = append(t.names, replica)
+		}
+	})
+}
+
+// addName adds a replica that is named outside of any clock, such as a writer
+func (t *replicaTable) addName(name string) {
+	if _, ok := t.index[name]; !ok && name != "" {
+		t.index[name] = 0
+		t.names = append(t.names, name)
+	}
+}
+
+// seal sorts the names so the encoding is deterministic
+func (t *replicaTable) seal() {
+	sort.Strings(t.names)
+	for i, name := range t.names {
+		t.index[name] = uint64(i)
+	}
+}
+
+// binWriter appends primitive values to a byte slice
+type binWriter struct {
+	buf []byte
+}
+
+func (w *binWriter) uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *binWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *binWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *binWriter) clock(t *replicaTable, vc *VectorClock) {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	entries := make([][2]uint64, 0, vc.lenLocked())
+	vc.eachLocked(func(replica string, counter uint64) {
+		entries = append(entries, [2]uint64{t.index[replica], counter})
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i][0] < entries[j][0] })
+
+	w.uvarint(uint64(len(entries)))
+	for _, e := range entries {
+		w.uvarint(e[0])
+		w.uvarint(e[1])
+	}
+}
+
+func (w *binWriter) timestamp(t Timestamp) {
+	w.uvarint(uint64(t.Wall))
+	w.uvarint(uint64(t.Logical))
+}
+
+// binReader reads primitive values and remembers the first error
+type binReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *binReader) fail(what string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: truncated %s at offset %d", ErrInvalidEncoding, what, r.pos)
+	}
+}
+
+func (r *binReader) byte() byte {
+	if r.err != nil || r.pos >= len(r.data) {
+		r.fail("byte")
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *binReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail("varint")
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// count reads a length and checks it against the remaining input
+func (r *binReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)-r.pos) {
+		r.fail("length")
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binReader) bytes() []byte {
+	n := r.count()
+	if r.err != nil {
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *binReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *binReader) timestamp() Timestamp {
+	wall := r.uvarint()
+	logical := r.uvarint()
+	if logical > math.MaxUint32 && r.err == nil {
+		r.err = fmt.Errorf("%w: logical time %d out of range", ErrInvalidEncoding, logical)
+	}
+	return Timestamp{Wall: int64(wall), Logical: uint32(logical)}
+}
+
+func (r *binReader) clock(names []string) *VectorClock {
+	vc := NewVectorClock()
+	n := r.count()
+	for i := 0; i < n && r.err == nil; i++ {
+		idx := r.uvarint()
+		counter := r.uvarint()
+		if idx >= uint64(len(names)) {
+			if r.err == nil {
+				r.err = fmt.Errorf("%w: replica index %d out of range", ErrInvalidEncoding, idx)
+			}
+			return vc
+		}
+		vc.clocks[names[idx]] = counter
+	}
+	return vc
+}
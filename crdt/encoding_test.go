@@ -0,0 +1,163 @@
+package marraycrdt
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// roundTrip encodes and decodes a replica through the binary format
+func roundTrip[T any](t *testing.T, ma *MArrayCRDT[T], opts ...Option) *MArrayCRDT[T] {
+	t.Helper()
+
+	data, err := ma.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	decoded := New[T]("other", opts...)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	return decoded
+}
+
+// TestBinaryRoundTripPreservesMerge tests that decoded replicas merge exactly like the originals
+func TestBinaryRoundTripPreservesMerge(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+	idC := replica1.Push("C")
+	_ = replica1.Push("D")
+	replica2.Merge(replica1)
+
+	// Concurrent edits including delete vs. move
+	replica1.Delete(idA)
+	replica1.Set(idB, "B1")
+	replica2.Move(idA, 3)
+	replica2.Set(idB, "B2")
+	replica2.Swap(idB, idC)
+
+	decoded1 := roundTrip(t, replica1)
+	decoded2 := roundTrip(t, replica2)
+
+	if decoded1.replicaID != "replica1" {
+		t.Errorf("Expected replica ID replica1, got %s", decoded1.replicaID)
+	}
+	if !reflect.DeepEqual(decoded1.ToSlice(), replica1.ToSlice()) {
+		t.Errorf("Round trip changed state: %v vs %v", decoded1.ToSlice(), replica1.ToSlice())
+	}
+
+	replica1.Merge(replica2)
+	decoded1.Merge(decoded2)
+	decoded2.Merge(replica1)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), decoded1.ToSlice()) ||
+		!reflect.DeepEqual(replica1.ToSlice(), decoded2.ToSlice()) {
+		t.Errorf("Decoded replicas merge differently!\nOriginal: %v\nDecoded1: %v\nDecoded2: %v",
+			replica1.ToSlice(), decoded1.ToSlice(), decoded2.ToSlice())
+	}
+
+	// Encoding is deterministic
+	data1, _ := replica1.MarshalBinary()
+	data2, _ := roundTrip(t, replica1).MarshalBinary()
+	if string(data1) != string(data2) {
+		t.Errorf("Re-encoding a decoded replica produced different bytes")
+	}
+}
+
+// TestBinaryStructValues tests the gob fallback for struct values
+func TestBinaryStructValues(t *testing.T) {
+	type Task struct {
+		Title    string
+		Priority int
+	}
+
+	replica := New[Task]("alice")
+	replica.Push(Task{"Write documentation", 2})
+	id := replica.Push(Task{"Fix bug #123", 1})
+	replica.Delete(id)
+
+	decoded := roundTrip(t, replica)
+	if !reflect.DeepEqual(decoded.ToSlice(), replica.ToSlice()) {
+		t.Errorf("Expected %v, got %v", replica.ToSlice(), decoded.ToSlice())
+	}
+	if len(decoded.items) != 2 {
+		t.Errorf("Expected tombstone to survive round trip, got %d items", len(decoded.items))
+	}
+}
+
+// upperCodec stores strings upper-cased to prove the codec is used
+type upperCodec struct{}
+
+func (upperCodec) EncodeValue(value string) ([]byte, error) {
+	return []byte(strings.ToUpper(value)), nil
+}
+
+func (upperCodec) DecodeValue(data []byte) (string, error) {
+	return strings.ToLower(string(data)), nil
+}
+
+// TestBinaryCustomCodec tests a pluggable value codec
+func TestBinaryCustomCodec(t *testing.T) {
+	replica := New[string]("replica1", WithValueCodec[string](upperCodec{}))
+	replica.Push("a")
+	replica.Push("b")
+
+	data, err := replica.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if !strings.Contains(string(data), "A") {
+		t.Errorf("Custom codec was not used for encoding")
+	}
+
+	decoded := roundTrip(t, replica, WithValueCodec[string](upperCodec{}))
+	if !reflect.DeepEqual(decoded.ToSlice(), []string{"a", "b"}) {
+		t.Errorf("Expected [a b], got %v", decoded.ToSlice())
+	}
+}
+
+// TestBinaryNilPointerValue tests that a nil pointer value is reported
+// instead of crashing the encoder
+func TestBinaryNilPointerValue(t *testing.T) {
+	replica := New[*MArrayCRDT[string]]("replica1")
+	replica.Push(nil)
+
+	if _, err := replica.MarshalBinary(); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected ErrInvalidEncoding for a nil value, got %v", err)
+	}
+}
+
+// TestBinaryRejectsCorruptData tests error reporting for bad input
+func TestBinaryRejectsCorruptData(t *testing.T) {
+	replica := New[int]("replica1")
+	replica.Push(1)
+	replica.Push(2)
+
+	data, _ := replica.MarshalBinary()
+
+	var decoded MArrayCRDT[int]
+	if err := decoded.UnmarshalBinary(data[:len(data)-3]); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected ErrInvalidEncoding for truncated data, got %v", err)
+	}
+	if err := decoded.UnmarshalBinary([]byte("nope")); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected ErrInvalidEncoding for bad magic, got %v", err)
+	}
+	other := slices.Clone(data)
+	other[len(binaryMagic)] = binaryVersion + 1
+	if err := decoded.UnmarshalBinary(other); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected ErrInvalidEncoding for another version, got %v", err)
+	}
+
+	// A zero value replica can be decoded into
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.ToSlice(), []int{1, 2}) {
+		t.Errorf("Expected [1 2], got %v", decoded.ToSlice())
+	}
+}
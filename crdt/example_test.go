@@ -4,7 +4,7 @@ import (
 	"fmt"
 )
 
-func ExampleShoppingList() {
+func Example_shoppingList() {
 	// Shopping list for two users
 	user1 := New[string]("user1")
 	user2 := New[string]("user2")
@@ -38,7 +38,7 @@ func ExampleShoppingList() {
 	// After sync: [Bread Milk Eggs (2 dozen)]
 }
 
-func ExampleTaskList() {
+func Example_taskList() {
 	type Task struct {
 		Title    string
 		Priority int
@@ -0,0 +1,203 @@
+package marraycrdt
+
+// Causal stability and tombstone garbage collection
+//
+// Every replica remembers the latest clock it has learned for each peer: the
+// clock of a replica it merged directly, or a clock relayed through another
+// replica's own peer table. The stable clock is the pointwise minimum over
+// this replica and every participant: every active member and every replica
+// that appears in a clock and has not left (see membership.go). An event
+// covered by the stable clock has been seen by everyone, so no concurrent
+// operation on it can still arrive.
+//
+// A replica that never wrote or merged appears in no clock, so only explicit
+// membership makes it known. Nothing is stable until this replica and every
+// participant have joined, and Fork registers the new replica as a member
+// before handing it out. A replica created with New must Join, and its join
+// must reach the group, before it copies state from anyone.
+//
+// A tombstone whose element clock (delete, moves and edits) is covered by the
+// stable clock has been seen by everyone, but a move made concurrently with
+// its delete may still be on its way, and without the tombstone it could
+// neither resurrect the element nor lose to the delete. Compact therefore
+// works in two steps. It remembers the stable clock together with the
+// frontier, the join of every participant's known clock, and only collects
+// the tombstones covered by that stable clock once a later stable clock
+// covers the frontier. Every participant had seen those deletes when it
+// reported its clock, so every move concurrent with them is part of the
+// frontier and has arrived by then. When the stable clock already covers the
+// frontier, Compact collects at once. Operations of one replica are assumed
+// to be applied in the order they were made, as Merge and any causal
+// transport guarantee.
+//
+// Merge skips tombstones covered by the last collection (the horizon) and
+// Apply drops operations for unknown elements whose clock is covered by the
+// stable clock, since they can only belong to an element that was collected.
+// Buffered operations of such elements are dropped by Compact. A replica that
+// still holds a collected tombstone and moves it after the fact brings it
+// back through Merge; operations carry no value, so its move stays buffered
+// on replicas that collected the element until then.
+
+// RecordPeerClock records that replicaID has seen everything in vc. Merge
+// does this automatically; op-based sync layers call it when a peer
+// acknowledges the operations it has applied.
+func (ma *MArrayCRDT[T]) RecordPeerClock(replicaID string, vc *VectorClock) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	ma.observePeerLocked(replicaID, vc)
+}
+
+// observePeerLocked merges vc into the known clock of replicaID (must hold lock)
+func (ma *MArrayCRDT[T]) observePeerLocked(replicaID string, vc *VectorClock) {
+	if replicaID == "" || replicaID == ma.replicaID || vc == nil {
+		return
+	}
+	if ma.peerClocks == nil {
+		ma.peerClocks = make(map[string]*VectorClock)
+	}
+
+	known, ok := ma.peerClocks[replicaID]
+	if !ok {
+		ma.peerClocks[replicaID] = vc.Clone()
+		return
+	}
+	known.Merge(vc)
+}
+
+// StableClock returns the clock of events every known replica has seen
+func (ma *MArrayCRDT[T]) StableClock() *VectorClock {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return ma.stableClockLocked()
+}
+
+// stableClockLocked computes the pointwise minimum over all participants
+// (must hold lock). It is empty while this replica or any participant has not
+// joined, and participants without a known clock pin it to zero.
+func (ma *MArrayCRDT[T]) stableClockLocked() *VectorClock {
+	if !ma.joinedLocked(ma.replicaID) {
+		return NewVectorClock()
+	}
+	own := ma.clock.toMap()
+
+	participants := make(map[string]bool, len(own)+len(ma.peerClocks)+len(ma.members))
+	for replica := range own {
+		participants[replica] = true
+	}
+	for replica := range ma.peerClocks {
+		participants[replica] = true
+	}
+	for replica := range ma.members {
+		participants[replica] = true
+	}
+
+	stable := NewVectorClock()
+	for replica, counter := range own {
+		stable.clocks[replica] = counter
+	}
+
+	for replica := range participants {
+		if replica == ma.replicaID || !ma.isActiveLocked(replica) {
+			continue
+		}
+		known, ok := ma.peerClocks[replica]
+		if !ok || !ma.joinedLocked(replica) {
+			return NewVectorClock()
+		}
+		seen := known.toMap()
+		for entry, counter := range stable.clocks {
+			if seen[entry] < counter {
+				stable.clocks[entry] = seen[entry]
+			}
+		}
+	}
+
+	return stable
+}
+
+// gcBarrier is the stable clock and frontier remembered by Compact
+type gcBarrier struct {
+	stable   *VectorClock
+	frontier *VectorClock
+}
+
+// frontierLocked returns the join of this replica's clock and the known
+// clocks of every active participant (must hold lock)
+func (ma *MArrayCRDT[T]) frontierLocked() *VectorClock {
+	frontier := ma.clock.Clone()
+	for replica, known := range ma.peerClocks {
+		if ma.isActiveLocked(replica) {
+			frontier.Merge(known)
+		}
+	}
+	return frontier
+}
+
+// Compact physically removes tombstones that no concurrent change can reach
+// any more and returns how many were dropped. A tombstone is collected by
+// the first Compact after everything its participants had seen when it
+// became stable has arrived, see the top of this file.
+func (ma *MArrayCRDT[T]) Compact() int {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	stable := ma.stableClockLocked()
+	frontier := ma.frontierLocked()
+
+	var limit *VectorClock
+	if stable.Dominates(frontier) {
+		limit = stable
+		ma.gcBarrier = nil
+	} else {
+		if b := ma.gcBarrier; b != nil && stable.Dominates(b.frontier) {
+			limit = b.stable
+			ma.gcBarrier = nil
+		}
+		if ma.gcBarrier == nil {
+			ma.gcBarrier = &gcBarrier{stable: stable, frontier: frontier}
+		}
+	}
+	if limit == nil {
+		return 0
+	}
+	ma.gcHorizon = limit
+
+	anchors := ma.markAnchorsLocked()
+	removed := 0
+	for id, elem := range ma.items {
+		if ma.collectableLocked(elem, limit) && !anchors[id] {
+			delete(ma.items, id)
+			delete(ma.pendingOps, id)
+			for _, op := range []OpType{OpSet, OpMove, OpDelete} {
+				delete(ma.undoStamps, undoField{id, op})
+			}
+			removed++
+		}
+	}
+
+	// Buffered operations covered by the stable clock wait for an element
+	// that was collected
+	for id, ops := range ma.pendingOps {
+		kept := ops[:0]
+		for _, op := range ops {
+			if !stable.Dominates(clockFromMap(op.Clock)) {
+				kept = append(kept, op)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ma.pendingOps, id)
+		} else {
+			ma.pendingOps[id] = kept
+		}
+	}
+
+	return removed
+}
+
+// collectableLocked reports whether elem is a tombstone whose element clock
+// is covered by limit (must hold lock)
+func (ma *MArrayCRDT[T]) collectableLocked(elem *Element[T], limit *VectorClock) bool {
+	return limit != nil && elem.Deleted && elem.DeleteClock != nil && limit.Dominates(elem.VectorClock)
+}
@@ -0,0 +1,277 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// joinAll makes every replica join and spreads the membership table
+func joinAll[T any](replicas ...*MArrayCRDT[T]) {
+	for _, r := range replicas {
+		r.Join()
+	}
+	syncAll(replicas...)
+}
+
+// syncAll merges every replica into every other one
+func syncAll[T any](replicas ...*MArrayCRDT[T]) {
+	for _, a := range replicas {
+		for _, b := range replicas {
+			if a != b {
+				a.Merge(b)
+			}
+		}
+	}
+}
+
+// TestCompactWaitsForStability tests that tombstones are only dropped once every replica saw them
+func TestCompactWaitsForStability(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	replica3 := New[string]("site3")
+	joinAll(replica1, replica2, replica3)
+
+	_ = replica1.Push("A")
+	idB := replica1.Push("B")
+	_ = replica1.Push("C")
+	syncAll(replica1, replica2, replica3)
+
+	replica1.Delete(idB)
+	replica2.Merge(replica1)
+
+	// site3 has not seen the delete yet
+	if n := replica1.Compact(); n != 0 {
+		t.Fatalf("Compacted %d tombstones before the delete was stable", n)
+	}
+	if n := replica2.Compact(); n != 0 {
+		t.Fatalf("Compacted %d tombstones before the delete was stable", n)
+	}
+
+	syncAll(replica1, replica2, replica3)
+	syncAll(replica1, replica2, replica3)
+
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2, replica3} {
+		if n := r.Compact(); n != 1 {
+			t.Errorf("%s: expected 1 compacted tombstone, got %d", r.replicaID, n)
+		}
+		if _, ok := r.items[idB]; ok {
+			t.Errorf("%s: tombstone still present after Compact", r.replicaID)
+		}
+		if !reflect.DeepEqual(r.ToSlice(), []string{"A", "C"}) {
+			t.Errorf("%s: expected [A C], got %v", r.replicaID, r.ToSlice())
+		}
+	}
+}
+
+// TestCompactedTombstoneNotReintroduced tests that merging a stale peer does not bring tombstones back
+func TestCompactedTombstoneNotReintroduced(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	joinAll(replica1, replica2)
+
+	_ = replica1.Push("A")
+	idB := replica1.Push("B")
+	replica1.Delete(idB)
+	syncAll(replica1, replica2)
+	syncAll(replica1, replica2)
+
+	if n := replica1.Compact(); n != 1 {
+		t.Fatalf("Expected 1 compacted tombstone, got %d", n)
+	}
+
+	// site2 still holds the tombstone
+	replica1.Merge(replica2)
+	if _, ok := replica1.items[idB]; ok {
+		t.Errorf("Merge re-added a compacted tombstone")
+	}
+}
+
+// TestResurrectAfterCompact tests move-resurrects-delete against a compacted replica
+func TestResurrectAfterCompact(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	joinAll(replica1, replica2)
+
+	_ = replica1.Push("A")
+	idB := replica1.Push("B")
+	replica1.Delete(idB)
+	syncAll(replica1, replica2)
+	syncAll(replica1, replica2)
+
+	replica1.Compact()
+
+	// site2 kept the tombstone and moves it back to life
+	if !replica2.Move(idB, 0) {
+		t.Fatalf("Move of tombstone failed")
+	}
+	replica1.Merge(replica2)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"B", "A"}) {
+		t.Errorf("Expected resurrected [B A], got %v", replica1.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge!\nReplica1: %v\nReplica2: %v",
+			replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestStableClockUnknownPeer tests that an unheard-of replica blocks stability
+func TestStableClockUnknownPeer(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	replica1.Join()
+	replica2.Join()
+	replica2.Push("X")
+	// Ops from site2 arrive without ever learning what site2 has seen
+	replica1.Merge(replica2.DeltaSince(nil))
+	id := replica1.Push("A")
+	replica1.Delete(id)
+
+	replica1.RecordPeerClock("site2", NewVectorClock())
+	if n := replica1.Compact(); n != 0 {
+		t.Errorf("Compacted %d tombstones with a lagging peer", n)
+	}
+
+	replica1.RecordPeerClock("site2", replica1.Clock())
+	if n := replica1.Compact(); n != 1 {
+		t.Errorf("Expected 1 compacted tombstone after acknowledgement, got %d", n)
+	}
+}
+
+// TestCompactNeedsMembership tests that nothing is stable while a writer has not joined
+func TestCompactNeedsMembership(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	id := replica1.Push("A")
+	replica1.Delete(id)
+	syncAll(replica1, replica2)
+	syncAll(replica1, replica2)
+
+	replica1.Join()
+	syncAll(replica1, replica2)
+	if n := replica1.Compact(); n != 0 {
+		t.Errorf("Compacted %d tombstones while site2 had not joined", n)
+	}
+
+	replica2.Join()
+	syncAll(replica1, replica2)
+	syncAll(replica1, replica2)
+	if n := replica1.Compact(); n != 1 {
+		t.Errorf("Expected 1 compacted tombstone once everyone joined, got %d", n)
+	}
+}
+
+// TestForkThenCompact tests that a fork that has not written or merged yet still holds back Compact
+func TestForkThenCompact(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica1.Join()
+	idA := replica1.Push("A")
+	_ = replica1.Push("B")
+
+	fork := replica1.Fork("site2")
+	replica1.Delete(idA)
+	if n := replica1.Compact(); n != 0 {
+		t.Fatalf("Compacted %d tombstones the fork still holds alive", n)
+	}
+
+	// The fork moves A concurrently with the delete and the tiebreak decides
+	fork.Move(idA, 1)
+	syncAll(replica1, fork)
+	if !reflect.DeepEqual(replica1.ToSlice(), fork.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, Fork: %v", replica1.ToSlice(), fork.ToSlice())
+	}
+
+	replica1.Delete(idA)
+	syncAll(replica1, fork)
+	syncAll(replica1, fork)
+	for _, r := range []*MArrayCRDT[string]{replica1, fork} {
+		if n := r.Compact(); n != 1 {
+			t.Errorf("%s: expected 1 compacted tombstone after sync, got %d", r.replicaID, n)
+		}
+	}
+}
+
+// TestCompactedOperationsNotReplayed tests that late operations for collected elements are dropped
+func TestCompactedOperationsNotReplayed(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	joinAll(replica1, replica2)
+	ops := collectOps(replica1)
+
+	id := replica1.Push("x")
+	replica1.Set(id, "y")
+	replica1.Delete(id)
+	syncAll(replica1, replica2)
+	syncAll(replica1, replica2)
+
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if n := r.Compact(); n != 1 {
+			t.Fatalf("%s: expected 1 compacted tombstone, got %d", r.replicaID, n)
+		}
+	}
+
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if err := r.Apply((*ops)[0]); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if r.Len() != 0 {
+			t.Errorf("%s: replayed insert resurrected a collected element: %v", r.replicaID, r.ToSlice())
+		}
+
+		if err := r.Apply((*ops)[1:]...); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if n := r.PendingOperations(); n != 0 {
+			t.Errorf("%s: %d operations for a collected element stayed pending", r.replicaID, n)
+		}
+	}
+}
+
+// TestCompactWaitsForConcurrentMoves tests that a tombstone survives Compact
+// while a move made concurrently with its delete is still on its way
+func TestCompactWaitsForConcurrentMoves(t *testing.T) {
+	a, b, c := New[string]("a"), New[string]("b"), New[string]("c")
+	joinAll(a, b, c)
+	x := a.Push("x")
+	_ = a.Push("y")
+	syncAll(a, b, c)
+	opsA, opsB := collectOps(a), collectOps(b)
+
+	// b moves x before it hears of the delete, and c hears of the move last
+	a.Delete(x)
+	b.Move(x, 2)
+	for _, r := range []*MArrayCRDT[string]{b, c} {
+		if err := r.Apply(*opsA...); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	c.RecordPeerClock("a", a.Clock())
+	c.RecordPeerClock("b", b.Clock())
+	if n := c.Compact(); n != 0 {
+		t.Fatalf("Compact dropped %d tombstones a concurrent move can still reach", n)
+	}
+
+	for _, r := range []*MArrayCRDT[string]{a, c} {
+		if err := r.Apply(*opsB...); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	if n := c.PendingOperations(); n != 0 {
+		t.Errorf("%d operations stayed pending", n)
+	}
+	for _, r := range []*MArrayCRDT[string]{a, b} {
+		if !reflect.DeepEqual(r.ToSlice(), c.ToSlice()) {
+			t.Errorf("Replicas did not converge! %s: %v, c: %v", r.replicaID, r.ToSlice(), c.ToSlice())
+		}
+	}
+
+	// Once the move has arrived everywhere the tombstone can go
+	a.Delete(x)
+	syncAll(a, b, c)
+	syncAll(a, b, c)
+	if n := c.Compact(); n != 1 {
+		t.Errorf("Expected 1 compacted tombstone, got %d", n)
+	}
+}
@@ -0,0 +1,116 @@
+package marraycrdt
+
+import "time"
+
+// Hybrid timestamps
+//
+// Every value write is stamped with a hybrid logical clock reading: the wall
+// time in nanoseconds, plus a logical counter that keeps readings increasing
+// when the wall clock stalls or runs backwards. A replica never issues a
+// reading below one it has already issued or received, so a write that
+// follows another one it has seen is also later in timestamp order. Vector
+// clocks still decide causality; timestamps only order concurrent writes for
+// resolvers such as LastWriterWins.
+//
+// WithHybridClock also stamps moves and deletes, and makes every concurrent
+// Last-Writer-Wins decision compare timestamps first: concurrent Sets default
+// to LastWriterWins, concurrent moves keep the later move, and a delete
+// racing a move goes to the later of the two. Equal timestamps, as every
+// element of one Sort, Reverse, Shuffle or Rotate carries, fall back to the
+// total clock order of compareReplicaOrder, so one bulk reorder wins all of
+// its ties against another. Writes made before the option was set carry no
+// timestamp and lose to stamped ones. Decoding observes every decoded
+// timestamp like Merge does. All replicas must use the option alike, as with
+// WithAutoSort.
+
+// Timestamp is a hybrid logical clock reading
+type Timestamp struct {
+	Wall    int64  `json:"wall"`
+	Logical uint32 `json:"logical,omitempty"`
+}
+
+// IsZero reports whether the timestamp was never set
+func (t Timestamp) IsZero() bool {
+	return t == Timestamp{}
+}
+
+// Compare returns -1, 0 or 1 as t is before, equal to or after u
+func (t Timestamp) Compare(u Timestamp) int {
+	switch {
+	case t.Wall < u.Wall:
+		return -1
+	case t.Wall > u.Wall:
+		return 1
+	case t.Logical < u.Logical:
+		return -1
+	case t.Logical > u.Logical:
+		return 1
+	}
+	return 0
+}
+
+// laterTimestamp returns the later of two timestamps
+func laterTimestamp(a, b Timestamp) Timestamp {
+	if b.Compare(a) > 0 {
+		return b
+	}
+	return a
+}
+
+// WithHybridClock stamps moves and deletes with hybrid timestamps and lets
+// timestamps decide concurrent writes. now is the wall clock source; nil uses
+// time.Now.
+func WithHybridClock(now func() time.Time) Option {
+	return func(c *Config) {
+		c.HybridClock = true
+		c.ClockSource = now
+	}
+}
+
+// nowLocked issues the next timestamp of this replica (must hold lock)
+func (ma *MArrayCRDT[T]) nowLocked() Timestamp {
+	now := time.Now
+	if ma.config.ClockSource != nil {
+		now = ma.config.ClockSource
+	}
+
+	wall := now().UnixNano()
+	if wall > ma.hlc.Wall {
+		ma.hlc = Timestamp{Wall: wall}
+	} else {
+		ma.hlc.Logical++
+	}
+	return ma.hlc
+}
+
+// hybridNowLocked issues a timestamp for a move or delete, which are only
+// stamped under WithHybridClock (must hold lock)
+func (ma *MArrayCRDT[T]) hybridNowLocked() Timestamp {
+	if !ma.config.HybridClock {
+		return Timestamp{}
+	}
+	return ma.nowLocked()
+}
+
+// hybridTime returns t for the index of a new element under WithHybridClock,
+// which shares the timestamp of its value
+func (ma *MArrayCRDT[T]) hybridTime(t Timestamp) Timestamp {
+	if !ma.config.HybridClock {
+		return Timestamp{}
+	}
+	return t
+}
+
+// observeElementTimeLocked observes every timestamp of elem (must hold lock)
+func (ma *MArrayCRDT[T]) observeElementTimeLocked(elem *Element[T]) {
+	ma.observeTimeLocked(elem.Value.Timestamp)
+	ma.observeTimeLocked(elem.Index.Timestamp)
+	ma.observeTimeLocked(elem.DeleteTime)
+}
+
+// observeTimeLocked moves the clock past a received timestamp (must hold lock)
+func (ma *MArrayCRDT[T]) observeTimeLocked(t Timestamp) {
+	if t.Compare(ma.hlc) > 0 {
+		ma.hlc = t
+	}
+}
@@ -0,0 +1,230 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fixedClock returns a clock source reading *now
+func fixedClock(now *time.Time) func() time.Time {
+	return func() time.Time { return *now }
+}
+
+// TestHybridClockMonotonic tests that timestamps keep increasing when the wall clock stalls or lags
+func TestHybridClockMonotonic(t *testing.T) {
+	now := time.Unix(1000, 0)
+	replica1 := New[string]("replica1", WithHybridClock(fixedClock(&now)))
+	id := replica1.Push("a")
+
+	var last Timestamp
+	for _, wall := range []int64{1000, 1000, 900} {
+		now = time.Unix(wall, 0)
+		replica1.Set(id, "b")
+		elem, _ := replica1.GetElement(id)
+		if elem.Value.Timestamp.Compare(last) <= 0 {
+			t.Fatalf("Timestamp did not advance: %v after %v", elem.Value.Timestamp, last)
+		}
+		last = elem.Value.Timestamp
+	}
+
+	// A write after merging a replica that runs ahead is stamped after it
+	ahead := time.Unix(5000, 0)
+	replica2 := New[string]("site2", WithHybridClock(fixedClock(&ahead)))
+	replica2.Merge(replica1)
+	replica2.Move(id, 0)
+	replica1.Merge(replica2)
+	replica1.Delete(id)
+	if elem := replica1.items[id]; elem.DeleteTime.Compare(Timestamp{Wall: ahead.UnixNano()}) <= 0 {
+		t.Errorf("Delete should be stamped after the merged move, got %v", elem.DeleteTime)
+	}
+}
+
+// TestHybridClockDecidesConcurrentWrites tests that later moves and deletes win regardless of replica ID
+func TestHybridClockDecidesConcurrentWrites(t *testing.T) {
+	for _, hybrid := range []bool{false, true} {
+		now := time.Unix(1000, 0)
+		log := NewConflictLog(0)
+		opts := []Option{WithConflictLog(log)}
+		if hybrid {
+			opts = append(opts, WithHybridClock(fixedClock(&now)))
+		}
+		replica1 := New[string]("replica1", opts...)
+		for _, c := range "abcd" {
+			replica1.Push(string(c))
+		}
+		replica2 := New[string]("site2", opts...)
+		replica2.Merge(replica1)
+		ids := replica1.IDs()
+
+		// site2 writes first and replica1 later; site2 has the higher ID
+		now = now.Add(time.Second)
+		replica2.Move(ids[0], 2)
+		replica2.Delete(ids[3])
+		now = now.Add(time.Second)
+		replica1.Move(ids[0], 4)
+		replica1.Move(ids[3], 0)
+
+		before := replica1.Clone()
+		replica1.Merge(replica2)
+		replica2.Merge(before)
+		if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+			t.Fatalf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+		}
+
+		expected := []string{"b", "c", "a"}
+		if hybrid {
+			expected = []string{"d", "b", "c", "a"}
+		}
+		if !reflect.DeepEqual(replica1.ToSlice(), expected) {
+			t.Errorf("hybrid=%v: expected %v, got %v", hybrid, expected, replica1.ToSlice())
+		}
+		for _, r := range log.Records() {
+			if hybrid && r.Rule != RuleTimestamp {
+				t.Errorf("Expected the timestamp rule for %s, got %s", r.Field, r.Rule)
+			}
+		}
+	}
+}
+
+// TestHybridTimestampsReplicate tests that ops and both encodings carry move and delete timestamps
+func TestHybridTimestampsReplicate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	replica1 := New[string]("replica1", WithHybridClock(fixedClock(&now)))
+	ops := collectOps(replica1)
+	a := replica1.Push("a")
+	b := replica1.Push("b")
+	replica1.Move(a, 2)
+	replica1.Delete(b)
+
+	viaOps := New[string]("site2", WithHybridClock(fixedClock(&now)))
+	if err := viaOps.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	data, err := replica1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	fromBinary := New[string]("other")
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	data, err = json.Marshal(replica1)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	fromJSON := New[string]("other")
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+
+	original, deleted := replica1.items[a], replica1.items[b]
+	if original.Index.Timestamp.IsZero() || deleted.DeleteTime.IsZero() {
+		t.Fatalf("Moves and deletes should be stamped")
+	}
+	for _, r := range []*MArrayCRDT[string]{viaOps, fromBinary, fromJSON} {
+		moved, gone := r.items[a], r.items[b]
+		if moved.Index.Timestamp != original.Index.Timestamp || gone.DeleteTime != deleted.DeleteTime {
+			t.Errorf("%s: timestamps were not carried over", r.replicaID)
+		}
+	}
+}
+
+// TestDecodingObservesTimestamps tests that a decoded replica issues
+// timestamps after every decoded one
+func TestDecodingObservesTimestamps(t *testing.T) {
+	later := time.Unix(2000, 0)
+	replica1 := New[string]("replica1", WithHybridClock(fixedClock(&later)))
+	id := replica1.Push("a")
+	replica1.Move(id, 0)
+	data, err := replica1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	jsonData, err := json.Marshal(replica1)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+
+	earlier := time.Unix(1000, 0)
+	fromBinary := New[string]("site2", WithHybridClock(fixedClock(&earlier)))
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	fromJSON := New[string]("site2", WithHybridClock(fixedClock(&earlier)))
+	if err := json.Unmarshal(jsonData, fromJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+
+	for _, r := range []*MArrayCRDT[string]{fromBinary, fromJSON} {
+		r.Move(id, 1)
+		if r.items[id].Index.Timestamp.Compare(replica1.items[id].Index.Timestamp) <= 0 {
+			t.Errorf("Move after decoding should be stamped after the decoded move")
+		}
+	}
+}
+
+// TestConcurrentBulkReordersConverge tests that concurrent Sort, Reverse,
+// Shuffle and Rotate calls, whose elements all share one timestamp, converge
+// under operation sync with stalled and running clocks
+func TestConcurrentBulkReordersConverge(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		now := time.Unix(1000, 0)
+		clock := fixedClock(&now)
+		if seed%2 == 1 {
+			clock = tickingClock(now, time.Nanosecond)
+		}
+		replicas := []*MArrayCRDT[string]{
+			New[string]("a", WithHybridClock(clock)),
+			New[string]("b", WithHybridClock(clock)),
+			New[string]("c", WithHybridClock(clock)),
+		}
+		ops := make([]*[]Operation[string], len(replicas))
+		for i, r := range replicas {
+			ops[i] = collectOps(r)
+		}
+
+		for round := 0; round < 5; round++ {
+			for _, r := range replicas {
+				switch rng.Intn(5) {
+				case 0:
+					r.Sort(func(a, b string) bool { return a < b })
+				case 1:
+					r.Reverse()
+				case 2:
+					r.Shuffle()
+				case 3:
+					r.Rotate(rng.Intn(5))
+				default:
+					randomEdit(rng, r)
+				}
+			}
+
+			var batch []Operation[string]
+			for i := range ops {
+				batch = append(batch, *ops[i]...)
+				*ops[i] = nil
+			}
+			for _, r := range replicas {
+				shuffled := append([]Operation[string](nil), batch...)
+				rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+				if err := r.Apply(shuffled...); err != nil {
+					t.Fatalf("seed %d: Apply failed: %v", seed, err)
+				}
+			}
+			for i := range ops {
+				*ops[i] = nil
+			}
+		}
+
+		for _, r := range replicas[1:] {
+			if !reflect.DeepEqual(r.ToSlice(), replicas[0].ToSlice()) {
+				t.Fatalf("seed %d: %s has %v, a has %v", seed, r.replicaID, r.ToSlice(), replicas[0].ToSlice())
+			}
+		}
+	}
+}
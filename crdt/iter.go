@@ -0,0 +1,84 @@
+package marraycrdt
+
+import "iter"
+
+// Iterators
+//
+// The iterators walk the persistent order tree directly, so nothing is
+// materialized and breaking out of a loop stops the walk. Iterators obtained
+// from the array take a fresh snapshot each time a loop starts over them;
+// iterators obtained from a Snapshot always see that snapshot.
+
+// All yields index and value of every live element in order
+func (s *Snapshot[T]) All() iter.Seq2[int, T] {
+	return s.Range(0, s.Len())
+}
+
+// Elements yields a read-only view of every live element in order
+func (s *Snapshot[T]) Elements() iter.Seq[ElementView[T]] {
+	return func(yield func(ElementView[T]) bool) {
+		walkNodes(s.root, 0, func(node *orderNode[T]) bool {
+			return yield(node.view())
+		})
+	}
+}
+
+// Range yields index and value of the live elements in [from, to). Bounds
+// are clamped to the array.
+func (s *Snapshot[T]) Range(from, to int) iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		from := max(from, 0)
+		to := min(to, s.Len())
+
+		i := from
+		walkNodes(s.root, from, func(node *orderNode[T]) bool {
+			if i >= to || !yield(i, node.value) {
+				return false
+			}
+			i++
+			return true
+		})
+	}
+}
+
+// Backward yields index and value of every live element from last to first
+func (s *Snapshot[T]) Backward() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		i := s.Len() - 1
+		walkNodesBackward(s.root, func(node *orderNode[T]) bool {
+			if !yield(i, node.value) {
+				return false
+			}
+			i--
+			return true
+		})
+	}
+}
+
+// All yields index and value of every live element in order
+func (ma *MArrayCRDT[T]) All() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		ma.rootView().All()(yield)
+	}
+}
+
+// Elements yields a read-only view of every live element in order
+func (ma *MArrayCRDT[T]) Elements() iter.Seq[ElementView[T]] {
+	return func(yield func(ElementView[T]) bool) {
+		ma.rootView().Elements()(yield)
+	}
+}
+
+// Range yields index and value of the live elements in [from, to)
+func (ma *MArrayCRDT[T]) Range(from, to int) iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		ma.rootView().Range(from, to)(yield)
+	}
+}
+
+// Backward yields index and value of every live element from last to first
+func (ma *MArrayCRDT[T]) Backward() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		ma.rootView().Backward()(yield)
+	}
+}
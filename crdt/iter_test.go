@@ -0,0 +1,97 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestIterators tests All, Elements, Range and Backward against ToSlice
+func TestIterators(t *testing.T) {
+	replica1 := New[int]("replica1")
+	for i := 0; i < 20; i++ {
+		_ = replica1.Push(i)
+	}
+	replica1.Reverse()
+	expected := replica1.ToSlice()
+
+	var all []int
+	for i, v := range replica1.All() {
+		if i != len(all) {
+			t.Fatalf("All: unexpected index %d", i)
+		}
+		all = append(all, v)
+	}
+	if !reflect.DeepEqual(all, expected) {
+		t.Errorf("All: expected %v, got %v", expected, all)
+	}
+
+	var ids []string
+	for e := range replica1.Elements() {
+		ids = append(ids, e.ID)
+	}
+	if !reflect.DeepEqual(ids, replica1.IDs()) {
+		t.Errorf("Elements: IDs differ from IDs()")
+	}
+
+	var ranged []int
+	for i, v := range replica1.Range(5, 9) {
+		if v != expected[i] {
+			t.Errorf("Range: index %d has %d, expected %d", i, v, expected[i])
+		}
+		ranged = append(ranged, v)
+	}
+	if !reflect.DeepEqual(ranged, expected[5:9]) {
+		t.Errorf("Range: expected %v, got %v", expected[5:9], ranged)
+	}
+	for range replica1.Range(-3, 100) {
+		ranged = append(ranged, 0)
+	}
+	if len(ranged) != 4+len(expected) {
+		t.Errorf("Range should clamp its bounds")
+	}
+
+	var backward []int
+	for i, v := range replica1.Backward() {
+		if v != expected[i] {
+			t.Errorf("Backward: index %d has %d, expected %d", i, v, expected[i])
+		}
+		backward = append(backward, v)
+	}
+	if len(backward) != len(expected) || backward[0] != expected[len(expected)-1] {
+		t.Errorf("Backward: got %v", backward)
+	}
+}
+
+// TestIteratorsStopEarlyOnSnapshot tests early exit and snapshot consistency during writes
+func TestIteratorsStopEarlyOnSnapshot(t *testing.T) {
+	replica1 := New[string]("replica1")
+	for _, v := range []string{"A", "B", "C", "D"} {
+		_ = replica1.Push(v)
+	}
+
+	var seen []string
+	for _, v := range replica1.All() {
+		seen = append(seen, v)
+		// Writes during iteration do not affect the running loop
+		replica1.Unshift("X")
+		if len(seen) == 2 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(seen, []string{"A", "B"}) {
+		t.Errorf("Expected [A B], got %v", seen)
+	}
+
+	count := 0
+	for range replica1.Backward() {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("Backward should stop after break, ran %d times", count)
+	}
+
+	if replica1.Len() != 6 {
+		t.Errorf("Expected 6 elements after writes, got %d", replica1.Len())
+	}
+}
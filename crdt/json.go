@@ -0,0 +1,314 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// JSON schema (version 1)
+//
+// A VectorClock is an object mapping replica IDs to counters:
+//
+//	{"replica1": 3, "site2": 1}
+//
+// A Timestamp is an object with the wall time in nanoseconds and a logical
+// counter that is omitted when zero:
+//
+//	{"wall": 1700000000000000000, "logical": 2}
+//
+// An Element is
+//
+//	{
+//	  "id":          "9f0c...",
+//	  "value":       <T as JSON>,
+//	  "valueClock":  <VectorClock>,
+//	  "valueTime":   <Timestamp>        (omitted when unset)
+//	  "valueWriter": "replica1",        (omitted when unknown)
+//	  "siblings":    [<Sibling>, ...],  (multi-value mode, omitted when empty)
+//	  "position":    "V9aZ3kQ11",
+//	  "indexClock":  <VectorClock>,
+//	  "indexTime":   <Timestamp>        (omitted when unset)
+//	  "clock":       <VectorClock>,
+//	  "deleted":     false,
+//	  "deleteClock": <VectorClock>      (omitted when absent)
+//	  "deleteTime":  <Timestamp>        (omitted when unset)
+//	}
+//
+// where a Sibling is a concurrent value
+//
+//	{"value": <T as JSON>, "clock": <VectorClock>, "time": <Timestamp>, "writer": "site2"}
+//
+// a Member is a membership entry
+//
+//	{"replicaId": "site2", "active": true, "clock": <VectorClock>}
+//
+// a Mark is a formatting mark whose value is any JSON value
+//
+//	{"id": "4b1e...", "key": "bold", "value": true, "start": "9f0c...",
+//	 "end": "a3d2...", "expand": 1, "clock": <VectorClock>}
+//
+// with "end" omitted when the mark runs to the end of the array, and a
+// replica is
+//
+//	{
+//	  "version":   1,
+//	  "replicaId": "replica1",
+//	  "clock":     <VectorClock>,
+//	  "elements":  [<Element>, ...]     (ordered by position, then id; tombstones included)
+//	  "members":   [<Member>, ...]      (ordered by replica id, omitted when empty)
+//	  "marks":     [<Mark>, ...]        (ordered by id, omitted when empty)
+//	}
+//
+// Live elements appear in array order once tombstones are skipped, so viewers
+// can render a replica without reimplementing the ordering rules. Arrays kept
+// with WithAutoSort are the exception: they are ordered by value, which the
+// document does not capture, so viewers have to sort them again. Documents
+// are only accepted in the version they are written in; a schema change
+// bumps the version.
+const jsonVersion = 1
+
+// MarshalJSON encodes the clock as an object of replica counters
+func (vc *VectorClock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(vc.toMap())
+}
+
+// UnmarshalJSON replaces the clock entries with the decoded object
+func (vc *VectorClock) UnmarshalJSON(data []byte) error {
+	var clocks map[string]uint64
+	if err := json.Unmarshal(data, &clocks); err != nil {
+		return err
+	}
+	if clocks == nil {
+		clocks = make(map[string]uint64)
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.clocks = clocks
+	vc.dot = dot{}
+	vc.owned.Store(true)
+	return nil
+}
+
+// elementJSON is the wire form of an Element
+type elementJSON[T any] struct {
+	ID          string           `json:"id"`
+	Value       T                `json:"value"`
+	ValueClock  *VectorClock     `json:"valueClock"`
+	ValueTime   *Timestamp       `json:"valueTime,omitempty"`
+	ValueWriter string           `json:"valueWriter,omitempty"`
+	Siblings    []siblingJSON[T] `json:"siblings,omitempty"`
+	Position    Position         `json:"position"`
+	IndexClock  *VectorClock     `json:"indexClock"`
+	IndexTime   *Timestamp       `json:"indexTime,omitempty"`
+	Clock       *VectorClock     `json:"clock"`
+	Deleted     bool             `json:"deleted"`
+	DeleteClock *VectorClock     `json:"deleteClock,omitempty"`
+	DeleteTime  *Timestamp       `json:"deleteTime,omitempty"`
+}
+
+// siblingJSON is the wire form of a concurrent value
+type siblingJSON[T any] struct {
+	Value  T            `json:"value"`
+	Clock  *VectorClock `json:"clock"`
+	Time   *Timestamp   `json:"time,omitempty"`
+	Writer string       `json:"writer,omitempty"`
+}
+
+// timeOrNil returns nil for an unset timestamp so it is omitted
+func timeOrNil(t Timestamp) *Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// timeOrZero returns the decoded timestamp, or zero if it was omitted
+func timeOrZero(t *Timestamp) Timestamp {
+	if t == nil {
+		return Timestamp{}
+	}
+	return *t
+}
+
+// MarshalJSON encodes the element with all of its per-field clocks
+func (e *Element[T]) MarshalJSON() ([]byte, error) {
+	var siblings []siblingJSON[T]
+	for _, sibling := range e.Value.Siblings {
+		siblings = append(siblings, siblingJSON[T]{
+			Value:  sibling.Data,
+			Clock:  sibling.VectorClock,
+			Time:   timeOrNil(sibling.Timestamp),
+			Writer: sibling.Writer,
+		})
+	}
+
+	return json.Marshal(elementJSON[T]{
+		ID:          e.ID,
+		Value:       e.Value.Data,
+		ValueClock:  e.Value.VectorClock,
+		ValueTime:   timeOrNil(e.Value.Timestamp),
+		ValueWriter: e.Value.Writer,
+		Siblings:    siblings,
+		Position:    e.Index.Position,
+		IndexClock:  e.Index.VectorClock,
+		IndexTime:   timeOrNil(e.Index.Timestamp),
+		Clock:       e.VectorClock,
+		Deleted:     e.Deleted,
+		DeleteClock: e.DeleteClock,
+		DeleteTime:  timeOrNil(e.DeleteTime),
+	})
+}
+
+// UnmarshalJSON decodes an element produced by MarshalJSON
+func (e *Element[T]) UnmarshalJSON(data []byte) error {
+	var raw elementJSON[T]
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.ID == "" {
+		return fmt.Errorf("%w: element without id", ErrInvalidEncoding)
+	}
+
+	value := &VersionedValue[T]{
+		Data:        raw.Value,
+		VectorClock: orEmptyClock(raw.ValueClock),
+		Timestamp:   timeOrZero(raw.ValueTime),
+		Writer:      raw.ValueWriter,
+	}
+	for _, s := range raw.Siblings {
+		value.Siblings = append(value.Siblings, &VersionedValue[T]{
+			Data:        s.Value,
+			VectorClock: orEmptyClock(s.Clock),
+			Timestamp:   timeOrZero(s.Time),
+			Writer:      s.Writer,
+		})
+	}
+
+	*e = Element[T]{
+		ID:          raw.ID,
+		Value:       value,
+		Index:       &VersionedIndex{Position: raw.Position, VectorClock: orEmptyClock(raw.IndexClock), Timestamp: timeOrZero(raw.IndexTime)},
+		VectorClock: orEmptyClock(raw.Clock),
+		Deleted:     raw.Deleted,
+		DeleteClock: raw.DeleteClock,
+		DeleteTime:  timeOrZero(raw.DeleteTime),
+	}
+	return nil
+}
+
+// memberJSON is the wire form of a membership entry
+type memberJSON struct {
+	ReplicaID string       `json:"replicaId"`
+	Active    bool         `json:"active"`
+	Clock     *VectorClock `json:"clock"`
+}
+
+// replicaJSON is the wire form of an MArrayCRDT
+type replicaJSON[T any] struct {
+	Version   int           `json:"version"`
+	ReplicaID string        `json:"replicaId"`
+	Clock     *VectorClock  `json:"clock"`
+	Elements  []*Element[T] `json:"elements"`
+	Members   []memberJSON  `json:"members,omitempty"`
+	Marks     []*Mark       `json:"marks,omitempty"`
+}
+
+// MarshalJSON encodes the full replica state using the documented schema
+func (ma *MArrayCRDT[T]) MarshalJSON() ([]byte, error) {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	elements := make([]*Element[T], 0, len(ma.items))
+	for _, elem := range ma.items {
+		elements = append(elements, elem)
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		if elements[i].Index.Position != elements[j].Index.Position {
+			return elements[i].Index.Position < elements[j].Index.Position
+		}
+		return elements[i].ID < elements[j].ID
+	})
+
+	var members []memberJSON
+	for _, replica := range ma.sortedMembersLocked() {
+		m := ma.members[replica]
+		members = append(members, memberJSON{ReplicaID: replica, Active: m.Active, Clock: m.Clock})
+	}
+
+	var marks []*Mark
+	for _, id := range ma.sortedMarkIDsLocked() {
+		marks = append(marks, ma.marks[id])
+	}
+
+	return json.Marshal(replicaJSON[T]{
+		Version:   jsonVersion,
+		ReplicaID: ma.replicaID,
+		Clock:     ma.clock,
+		Elements:  elements,
+		Members:   members,
+		Marks:     marks,
+	})
+}
+
+// UnmarshalJSON replaces the replica state with a document produced by
+// MarshalJSON. Configuration and registered handlers are kept.
+func (ma *MArrayCRDT[T]) UnmarshalJSON(data []byte) error {
+	var raw replicaJSON[T]
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Version != jsonVersion {
+		return fmt.Errorf("%w: unsupported JSON version %d", ErrInvalidEncoding, raw.Version)
+	}
+
+	items := make(map[string]*Element[T], len(raw.Elements))
+	for _, elem := range raw.Elements {
+		if elem == nil {
+			return fmt.Errorf("%w: null element", ErrInvalidEncoding)
+		}
+		items[elem.ID] = elem
+	}
+	members := make(map[string]*member, len(raw.Members))
+	for _, m := range raw.Members {
+		members[m.ReplicaID] = &member{Active: m.Active, Clock: orEmptyClock(m.Clock)}
+	}
+	marks := make(map[string]*Mark, len(raw.Marks))
+	for _, mark := range raw.Marks {
+		if mark == nil || mark.ID == "" {
+			return fmt.Errorf("%w: mark without id", ErrInvalidEncoding)
+		}
+		mark.Clock = orEmptyClock(mark.Clock)
+		marks[mark.ID] = mark
+	}
+
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	if ma.items == nil {
+		ma.config = defaultConfig()
+	}
+	ma.replicaID = raw.ReplicaID
+	ma.clock = orEmptyClock(raw.Clock)
+	ma.items = items
+	for _, elem := range items {
+		ma.observeElementTimeLocked(elem)
+	}
+	ma.pendingOps = nil
+	ma.gcBarrier, ma.gcHorizon = nil, nil
+	ma.members, ma.memberClock = nil, nil
+	ma.mergeMembersLocked(members)
+	ma.marks = marks
+	ma.shareClocksLocked()
+	ma.rebuildOrderLocked()
+
+	return nil
+}
+
+func orEmptyClock(vc *VectorClock) *VectorClock {
+	if vc == nil {
+		return NewVectorClock()
+	}
+	return vc
+}
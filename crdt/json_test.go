@@ -0,0 +1,108 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestJSONRoundTripPreservesMerge tests that JSON-decoded replicas merge like the originals
+func TestJSONRoundTripPreservesMerge(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+	_ = replica1.Push("C")
+	replica2.Merge(replica1)
+
+	replica1.Delete(idA)
+	replica2.Move(idA, 2)
+	replica2.Set(idB, "B2")
+
+	data, err := json.Marshal(replica2)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded MArrayCRDT[string]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if decoded.replicaID != "site2" {
+		t.Errorf("Expected replica ID site2, got %s", decoded.replicaID)
+	}
+	if !reflect.DeepEqual(decoded.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Round trip changed state: %v vs %v", decoded.ToSlice(), replica2.ToSlice())
+	}
+
+	expected := replica1.Clone()
+	expected.Merge(replica2)
+	replica1.Merge(&decoded)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), expected.ToSlice()) {
+		t.Errorf("Decoded replica merges differently: %v vs %v",
+			replica1.ToSlice(), expected.ToSlice())
+	}
+}
+
+// TestJSONSchema tests the documented field names
+func TestJSONSchema(t *testing.T) {
+	replica := New[int]("replica1")
+	replica.Push(1)
+	id := replica.Push(2)
+	replica.Delete(id)
+
+	data, err := json.Marshal(replica)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var doc struct {
+		Version   int               `json:"version"`
+		ReplicaID string            `json:"replicaId"`
+		Clock     map[string]uint64 `json:"clock"`
+		Elements  []map[string]any  `json:"elements"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if doc.Version != jsonVersion || doc.ReplicaID != "replica1" || doc.Clock["replica1"] != 4 {
+		t.Errorf("Unexpected header: %+v", doc)
+	}
+	if len(doc.Elements) != 2 {
+		t.Fatalf("Expected 2 elements, got %d", len(doc.Elements))
+	}
+	for _, key := range []string{"id", "value", "valueClock", "position", "indexClock", "clock", "deleted"} {
+		if _, ok := doc.Elements[0][key]; !ok {
+			t.Errorf("Element is missing key %q", key)
+		}
+	}
+	if _, ok := doc.Elements[0]["deleteClock"]; ok {
+		t.Errorf("Live element should omit deleteClock")
+	}
+	if doc.Elements[1]["deleted"] != true || doc.Elements[1]["deleteClock"] == nil {
+		t.Errorf("Tombstone not encoded: %v", doc.Elements[1])
+	}
+}
+
+// TestJSONGetElement tests that cloned elements dump their clocks
+func TestJSONGetElement(t *testing.T) {
+	replica := New[string]("replica1")
+	id := replica.Push("A")
+
+	elem, _ := replica.GetElement(id)
+	data, err := json.Marshal(elem)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var decoded Element[string]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Value.Data != "A" || decoded.VectorClock.toMap()["replica1"] != 1 {
+		t.Errorf("Unexpected element after round trip: %s", data)
+	}
+}
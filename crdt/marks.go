@@ -0,0 +1,360 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// Formatting marks
+//
+// Marks attach attributes such as bold, a link target or a comment to a
+// range of elements, following Peritext. A mark does not store indices but
+// the elements at its edges: it starts just before its first element and
+// ends either just after its last element (ExpandNone, for links and
+// comments) or just before the element that followed the range
+// (ExpandAfter, for bold or italic). Elements inserted concurrently at the
+// start of a mark therefore stay outside it, and elements inserted at its end
+// join it only if the mark expands. Tombstones keep their positions, so a
+// mark whose edge element is deleted still covers the same stretch.
+//
+// Marks are immutable once created, so replicas merge them as a grow-only
+// set, and every mark advances the replica clock like an element change.
+// Every element takes, per key, the value of the latest mark covering it; a
+// mark with a nil value removes the key. Latest is a total order consistent
+// with causality: the mark whose clock has the larger sum wins, ties go to
+// the larger mark ID. Keys are independent, so overlapping comments need
+// distinct keys such as "comment:<id>".
+//
+// Marks travel with Merge, Clone, DeltaSince, operations (OpMark) and both
+// encodings, and Compact keeps the tombstones they are anchored to. Adding a
+// mark reports ChangeFormatted for every live element it covers, joins the
+// running transaction and is recorded for undo. Undo cannot delete a mark;
+// it adds marks that restore the values the key had before. Encodings store
+// mark values as JSON, so they should be JSON values; numbers decode as
+// float64.
+
+// MarkExpand selects whether a mark grows when elements are inserted at its end
+type MarkExpand int
+
+const (
+	// ExpandNone keeps elements inserted at the end of the mark outside it
+	ExpandNone MarkExpand = iota
+	// ExpandAfter lets elements inserted at the end of the mark join it
+	ExpandAfter
+)
+
+// Mark is one formatting operation over a range of elements
+type Mark struct {
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+
+	// Start is the first element covered. End is the last element covered
+	// with ExpandNone, or the element after the range with ExpandAfter, where
+	// an empty End means the end of the array.
+	Start  string     `json:"start"`
+	End    string     `json:"end,omitempty"`
+	Expand MarkExpand `json:"expand"`
+
+	Clock *VectorClock `json:"clock,omitempty"`
+}
+
+// Span is a maximal range [From, To) of live elements sharing the same
+// attributes
+type Span struct {
+	From  int
+	To    int
+	Attrs map[string]any
+}
+
+// AddMark sets key to value for the live elements in [from, to) and returns
+// the mark ID, or "" if the range is empty
+func (ma *MArrayCRDT[T]) AddMark(from, to int, key string, value any, expand MarkExpand) string {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.addMarkLocked(from, to, key, value, expand)
+}
+
+// RemoveMark removes key from the live elements in [from, to) and returns the
+// mark ID, or "" if the range is empty
+func (ma *MArrayCRDT[T]) RemoveMark(from, to int, key string, expand MarkExpand) string {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.addMarkLocked(from, to, key, nil, expand)
+}
+
+// addMarkLocked implements AddMark and RemoveMark (must hold lock)
+func (ma *MArrayCRDT[T]) addMarkLocked(from, to int, key string, value any, expand MarkExpand) string {
+	from = max(from, 0)
+	to = min(to, ma.orderLocked().len())
+	if from >= to {
+		return ""
+	}
+
+	mark := &Mark{Key: key, Value: value, Expand: expand}
+	mark.Start, mark.End = ma.markEdgesLocked(from, to, expand)
+	return ma.putMarkLocked(mark)
+}
+
+// markEdgesLocked returns the edge elements of a mark over the live elements
+// in [from, to), which must not be empty (must hold lock)
+func (ma *MArrayCRDT[T]) markEdgesLocked(from, to int, expand MarkExpand) (string, string) {
+	order := ma.orderLocked()
+	start := order.at(from).ID
+	if expand == ExpandNone {
+		return start, order.at(to - 1).ID
+	}
+	if next := order.at(to); next != nil {
+		return start, next.ID
+	}
+	return start, ""
+}
+
+// putMarkLocked stamps a new local mark with an ID and a clock, stores it and
+// emits it (must hold lock)
+func (ma *MArrayCRDT[T]) putMarkLocked(mark *Mark) string {
+	mark.ID = generateUUID()
+	ma.recordMarkUndoLocked(mark)
+	if ma.tx != nil {
+		ma.tx.marks = append(ma.tx.marks, mark.ID)
+	}
+
+	ma.clock.Increment(ma.replicaID)
+	mark.Clock = ma.clock.Fork()
+	ma.storeMarkLocked(mark)
+	ma.emitMarkLocked(mark)
+	return mark.ID
+}
+
+// storeMarkLocked adds a mark and reports it to observers (must hold lock)
+func (ma *MArrayCRDT[T]) storeMarkLocked(mark *Mark) {
+	if ma.marks == nil {
+		ma.marks = make(map[string]*Mark)
+	}
+	ma.marks[mark.ID] = mark
+	ma.noteMarkLocked(mark)
+}
+
+// Marks returns every mark, including those that no longer cover anything
+func (ma *MArrayCRDT[T]) Marks() []Mark {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	marks := make([]Mark, 0, len(ma.marks))
+	for _, mark := range ma.sortedMarksLocked() {
+		marks = append(marks, *mark.clone())
+	}
+	return marks
+}
+
+// Spans returns the formatted ranges of the array in order. Ranges without
+// any attribute are left out.
+func (ma *MArrayCRDT[T]) Spans() []Span {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	// Resolve every mark to an index range
+	type bounds struct {
+		mark     *Mark
+		from, to int
+	}
+	var ranges []bounds
+	var cuts []int
+	for _, mark := range ma.sortedMarksLocked() {
+		from, to, ok := ma.markRangeLocked(mark)
+		if !ok || from >= to {
+			continue
+		}
+		ranges = append(ranges, bounds{mark, from, to})
+		cuts = append(cuts, from, to)
+	}
+	slices.Sort(cuts)
+	cuts = slices.Compact(cuts)
+
+	// Apply the marks in order to every stretch between two cuts
+	var spans []Span
+	for i := 0; i+1 < len(cuts); i++ {
+		from, to := cuts[i], cuts[i+1]
+
+		attrs := make(map[string]any)
+		for _, r := range ranges {
+			if r.from > from || r.to < to {
+				continue
+			}
+			if r.mark.Value == nil {
+				delete(attrs, r.mark.Key)
+			} else {
+				attrs[r.mark.Key] = r.mark.Value
+			}
+		}
+		if len(attrs) == 0 {
+			continue
+		}
+
+		if n := len(spans); n > 0 && spans[n-1].To == from && reflect.DeepEqual(spans[n-1].Attrs, attrs) {
+			spans[n-1].To = to
+			continue
+		}
+		spans = append(spans, Span{From: from, To: to, Attrs: attrs})
+	}
+	return spans
+}
+
+// markRangeLocked resolves a mark to the live index range it covers. It
+// fails if an edge element is unknown to this replica. (must hold lock)
+func (ma *MArrayCRDT[T]) markRangeLocked(mark *Mark) (int, int, bool) {
+	order := ma.orderLocked()
+
+	start, ok := ma.items[mark.Start]
+	if !ok {
+		return 0, 0, false
+	}
+	from := order.countBefore(start)
+
+	if mark.End == "" {
+		return from, order.len(), true
+	}
+	end, ok := ma.items[mark.End]
+	if !ok {
+		return 0, 0, false
+	}
+	to := order.countBefore(end)
+	if mark.Expand == ExpandNone && !end.Deleted {
+		to++
+	}
+	return from, to, true
+}
+
+// sortedMarksLocked returns the marks from oldest to latest (must hold lock)
+func (ma *MArrayCRDT[T]) sortedMarksLocked() []*Mark {
+	marks := make([]*Mark, 0, len(ma.marks))
+	sums := make(map[string]uint64, len(ma.marks))
+	for _, mark := range ma.marks {
+		marks = append(marks, mark)
+		for _, counter := range mark.Clock.toMap() {
+			sums[mark.ID] += counter
+		}
+	}
+
+	sort.Slice(marks, func(i, j int) bool {
+		a, b := marks[i], marks[j]
+		if sums[a.ID] != sums[b.ID] {
+			return sums[a.ID] < sums[b.ID]
+		}
+		return a.ID < b.ID
+	})
+	return marks
+}
+
+// sortedMarkIDsLocked returns the mark IDs in ascending order (must hold lock)
+func (ma *MArrayCRDT[T]) sortedMarkIDsLocked() []string {
+	ids := make([]string, 0, len(ma.marks))
+	for id := range ma.marks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// mergeMarksLocked adds the marks this replica has not seen yet (must hold lock)
+func (ma *MArrayCRDT[T]) mergeMarksLocked(remote map[string]*Mark) {
+	for id, mark := range remote {
+		if _, exists := ma.marks[id]; exists {
+			continue
+		}
+		ma.storeMarkLocked(mark.clone())
+		ma.clock.Merge(mark.Clock)
+	}
+}
+
+// keyRunsLocked returns the values key had over the live elements in
+// [from, to), as marks anchored like a mark with the given expansion. A nil
+// value means the key was not set. (must hold lock)
+func (ma *MArrayCRDT[T]) keyRunsLocked(from, to int, key string, expand MarkExpand) []*Mark {
+	type bounds struct {
+		value    any
+		from, to int
+	}
+	var ranges []bounds
+	cuts := []int{from, to}
+	for _, mark := range ma.sortedMarksLocked() {
+		if mark.Key != key {
+			continue
+		}
+		f, t, ok := ma.markRangeLocked(mark)
+		f, t = max(f, from), min(t, to)
+		if !ok || f >= t {
+			continue
+		}
+		ranges = append(ranges, bounds{mark.Value, f, t})
+		cuts = append(cuts, f, t)
+	}
+	slices.Sort(cuts)
+	cuts = slices.Compact(cuts)
+
+	var runs []bounds
+	for i := 0; i+1 < len(cuts); i++ {
+		var value any
+		for _, r := range ranges {
+			if r.from <= cuts[i] && r.to >= cuts[i+1] {
+				value = r.value
+			}
+		}
+		if n := len(runs); n > 0 && reflect.DeepEqual(runs[n-1].value, value) {
+			runs[n-1].to = cuts[i+1]
+			continue
+		}
+		runs = append(runs, bounds{value, cuts[i], cuts[i+1]})
+	}
+
+	marks := make([]*Mark, len(runs))
+	for i, run := range runs {
+		marks[i] = &Mark{Key: key, Value: run.value, Expand: expand}
+		marks[i].Start, marks[i].End = ma.markEdgesLocked(run.from, run.to, expand)
+	}
+	return marks
+}
+
+// markAnchorsLocked returns the IDs of the elements marks are anchored to
+// (must hold lock)
+func (ma *MArrayCRDT[T]) markAnchorsLocked() map[string]bool {
+	anchors := make(map[string]bool, 2*len(ma.marks))
+	for _, mark := range ma.marks {
+		anchors[mark.Start] = true
+		if mark.End != "" {
+			anchors[mark.End] = true
+		}
+	}
+	return anchors
+}
+
+// emitMarkLocked queues an OpMark operation for a local mark (must hold lock)
+func (ma *MArrayCRDT[T]) emitMarkLocked(mark *Mark) {
+	if len(ma.opHandlers) == 0 {
+		return
+	}
+
+	content := *mark
+	content.Clock = nil
+	ma.outbox = append(ma.outbox, Operation[T]{
+		Type:   OpMark,
+		ID:     mark.ID,
+		Origin: ma.replicaID,
+		Clock:  mark.Clock.toMap(),
+		Mark:   &content,
+	})
+}
+
+// clone returns a copy of the mark with its own clock
+func (m *Mark) clone() *Mark {
+	c := *m
+	c.Clock = m.Clock.Clone()
+	return &c
+}
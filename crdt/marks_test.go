@@ -0,0 +1,236 @@
+package marraycrdt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newTestChars returns a replica holding one element per character of s
+func newTestChars(replicaID, s string) *MArrayCRDT[string] {
+	ma := New[string](replicaID)
+	for _, c := range s {
+		_ = ma.Push(string(c))
+	}
+	return ma
+}
+
+// TestMarkSpans tests overlapping marks and removal on one replica
+func TestMarkSpans(t *testing.T) {
+	replica1 := newTestChars("replica1", "abcdefgh")
+
+	replica1.AddMark(1, 4, "bold", true, ExpandAfter)
+	replica1.AddMark(2, 6, "link", "https://example.com", ExpandNone)
+	replica1.RemoveMark(2, 3, "bold", ExpandAfter)
+	if id := replica1.AddMark(5, 5, "italic", true, ExpandAfter); id != "" {
+		t.Errorf("Empty range should not create a mark")
+	}
+
+	expected := []Span{
+		{From: 1, To: 2, Attrs: map[string]any{"bold": true}},
+		{From: 2, To: 3, Attrs: map[string]any{"link": "https://example.com"}},
+		{From: 3, To: 4, Attrs: map[string]any{"bold": true, "link": "https://example.com"}},
+		{From: 4, To: 6, Attrs: map[string]any{"link": "https://example.com"}},
+	}
+	if spans := replica1.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Expected %v, got %v", expected, spans)
+	}
+	if len(replica1.Marks()) != 3 {
+		t.Errorf("Expected 3 marks, got %d", len(replica1.Marks()))
+	}
+}
+
+// TestMarkBoundariesUnderConcurrentInserts tests Peritext expansion rules
+func TestMarkBoundariesUnderConcurrentInserts(t *testing.T) {
+	replica1 := newTestChars("replica1", "abcdef")
+	replica2 := New[string]("site2")
+	replica2.Merge(replica1)
+
+	// bold covers "bc" and grows at its end, the link covers "de" and does not
+	replica1.AddMark(1, 3, "bold", true, ExpandAfter)
+	replica1.AddMark(3, 5, "link", "x", ExpandNone)
+
+	replica2.Insert(5, "3") // end of the link
+	replica2.Insert(3, "2") // end of bold, start of the link
+	replica2.Insert(1, "1") // start of bold
+
+	syncAll(replica1, replica2)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"a", "1", "b", "c", "2", "d", "e", "3", "f"}) {
+		t.Fatalf("Unexpected order: %v", replica1.ToSlice())
+	}
+	expected := []Span{
+		{From: 2, To: 5, Attrs: map[string]any{"bold": true}},
+		{From: 5, To: 7, Attrs: map[string]any{"link": "x"}},
+	}
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if spans := r.Spans(); !reflect.DeepEqual(spans, expected) {
+			t.Errorf("%s: expected %v, got %v", r.replicaID, expected, spans)
+		}
+	}
+}
+
+// TestConcurrentMarksConverge tests that concurrent marks on one key resolve the same everywhere
+func TestConcurrentMarksConverge(t *testing.T) {
+	replica1 := newTestChars("replica1", "abcdef")
+	replica2 := New[string]("site2")
+	replica2.Merge(replica1)
+
+	replica1.AddMark(0, 4, "bold", true, ExpandAfter)
+	replica2.RemoveMark(2, 6, "bold", ExpandAfter)
+	replica2.AddMark(1, 3, "color", "red", ExpandNone)
+
+	syncAll(replica1, replica2)
+
+	if !reflect.DeepEqual(replica1.Spans(), replica2.Spans()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.Spans(), replica2.Spans())
+	}
+
+	// A causally later mark always wins
+	replica2.AddMark(0, 6, "bold", true, ExpandAfter)
+	replica1.Merge(replica2)
+	spans := replica1.Spans()
+	if len(spans) == 0 || spans[0].From != 0 || spans[len(spans)-1].To != 6 || spans[0].Attrs["bold"] != true {
+		t.Errorf("Later bold should cover everything, got %v", spans)
+	}
+}
+
+// TestMarksKeepDeletedAnchors tests marks whose edge elements are deleted and compacted
+func TestMarksKeepDeletedAnchors(t *testing.T) {
+	replica1 := newTestChars("replica1", "abcdef")
+	replica2 := New[string]("site2")
+	replica2.Merge(replica1)
+
+	replica1.AddMark(1, 4, "comment:1", "check this", ExpandNone)
+	ids := replica1.IDs()
+	replica1.Delete(ids[1])
+	replica1.Delete(ids[3])
+
+	replica2.Merge(replica1)
+	replica1.Merge(replica2)
+	if removed := replica1.Compact(); removed != 0 {
+		t.Errorf("Compact removed %d anchored tombstones", removed)
+	}
+	if len(replica1.DeltaSince(replica2.Clock()).Marks()) != 0 {
+		t.Errorf("Delta should not repeat marks the peer has seen")
+	}
+
+	expected := []Span{{From: 1, To: 2, Attrs: map[string]any{"comment:1": "check this"}}}
+	if spans := replica1.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Expected %v, got %v", expected, spans)
+	}
+	if spans := replica1.Clone().Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Clone lost marks: %v", spans)
+	}
+}
+
+// TestMarksTravelWithOpsAndEncodings tests that marks reach other replicas
+// through operations and survive both encodings
+func TestMarksTravelWithOpsAndEncodings(t *testing.T) {
+	replica1 := newTestChars("replica1", "abcdef")
+	replica2 := New[string]("site2")
+	replica2.Merge(replica1)
+	ops := collectOps(replica1)
+
+	replica1.AddMark(0, 3, "bold", true, ExpandAfter)
+	replica1.AddMark(2, 5, "link", "x", ExpandNone)
+	replica1.RemoveMark(1, 2, "bold", ExpandAfter)
+
+	if err := replica2.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	expected := replica1.Spans()
+	if spans := replica2.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Apply: expected %v, got %v", expected, spans)
+	}
+	if !replica2.Clock().Dominates(replica1.Clock()) {
+		t.Errorf("Applied marks should advance the replica clock")
+	}
+
+	if spans := roundTrip(t, replica1).Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Binary: expected %v, got %v", expected, spans)
+	}
+	data, err := replica1.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	decoded := New[string]("other")
+	if err := decoded.UnmarshalJSON(data); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if spans := decoded.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("JSON: expected %v, got %v", expected, spans)
+	}
+}
+
+// TestMarksAreLocalChanges tests that marks produce change events, join
+// transactions and can be undone
+func TestMarksAreLocalChanges(t *testing.T) {
+	replica1 := newTestChars("replica1", "abcdef")
+	batches := collectEvents(replica1)
+	um := newTestUndoManager(replica1)
+
+	replica1.AddMark(1, 3, "bold", true, ExpandAfter)
+	if len(*batches) != 1 || !reflect.DeepEqual(kinds((*batches)[0]), []ChangeKind{ChangeFormatted, ChangeFormatted}) {
+		t.Fatalf("Expected two formatted events, got %v", *batches)
+	}
+	if e := (*batches)[0][1]; e.OldIndex != 2 || e.NewIndex != 2 || e.Value != "c" || !e.Local {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	replica1.AddMark(2, 5, "bold", "heavy", ExpandAfter)
+	if !um.Undo() {
+		t.Fatalf("Undo failed")
+	}
+	expected := []Span{{From: 1, To: 3, Attrs: map[string]any{"bold": true}}}
+	if spans := replica1.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Undo: expected %v, got %v", expected, spans)
+	}
+	if !um.Redo() {
+		t.Fatalf("Redo failed")
+	}
+	expected = []Span{
+		{From: 1, To: 2, Attrs: map[string]any{"bold": true}},
+		{From: 2, To: 5, Attrs: map[string]any{"bold": "heavy"}},
+	}
+	if spans := replica1.Spans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Redo: expected %v, got %v", expected, spans)
+	}
+
+	marks := len(replica1.Marks())
+	clock := replica1.Clock()
+	err := replica1.Transact(func(tx *Tx[string]) error {
+		tx.AddMark(0, 6, "italic", true, ExpandAfter)
+		return errors.New("abort")
+	})
+	if err == nil || len(replica1.Marks()) != marks || !clock.Dominates(replica1.Clock()) {
+		t.Errorf("Rolled back transaction should leave no mark")
+	}
+}
+
+// TestRolledBackMarkReportsNothing tests that a mark added by a transaction
+// that fails produces no change events
+func TestRolledBackMarkReportsNothing(t *testing.T) {
+	replica1 := newTestChars("replica1", "abc")
+	batches := collectEvents(replica1)
+
+	err := replica1.Transact(func(tx *Tx[string]) error {
+		tx.AddMark(0, 2, "bold", true, ExpandAfter)
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatalf("Transact should fail")
+	}
+	if len(*batches) != 0 {
+		t.Errorf("Expected no events, got %v", *batches)
+	}
+
+	// A mark that the same transaction keeps is still reported
+	_ = replica1.Transact(func(tx *Tx[string]) error {
+		tx.AddMark(1, 2, "bold", true, ExpandAfter)
+		return nil
+	})
+	if len(*batches) != 1 || !reflect.DeepEqual(kinds((*batches)[0]), []ChangeKind{ChangeFormatted}) {
+		t.Errorf("Expected one formatted event, got %v", *batches)
+	}
+}
@@ -5,25 +5,63 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"math"
 	mathrand "math/rand"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // MArrayCRDT is a Movable Array CRDT that supports full array operations
 // including move, sort, reverse, and more while maintaining convergence
 type MArrayCRDT[T any] struct {
-	mu     sync.RWMutex
-	items  map[string]*Element[T]
+	mu        sync.RWMutex
+	items     map[string]*Element[T]
 	replicaID string
-	clock  *VectorClock
-	config Config
+	clock     *VectorClock
+	config    Config
+
+	// Visible order of live elements, see order.go
+	order *orderTree[T]
+
+	// positionSeq numbers position allocations made by this replica
+	positionSeq uint64
+
+	// peerClocks holds the latest clock known for every other replica
+	peerClocks map[string]*VectorClock
+
+	// Two-step tombstone collection and the stable clock it last collected
+	// up to, see gc.go
+	gcBarrier *gcBarrier
+	gcHorizon *VectorClock
+
+	// members is the replicated join/leave table, counted by memberClock
+	members     map[string]*member
+	memberClock *VectorClock
+
+	// marks holds the formatting marks, see marks.go
+	marks map[string]*Mark
+
+	// Hybrid clock for timestamps, see hlc.go
+	hlc Timestamp
+
+	// Operation-based replication
+	opHandlers []func(ops []Operation[T])
+	outbox     []Operation[T]
+	pendingOps map[string][]Operation[T]
+	opContexts contextCache
 
-	// Cache for performance
-	sortedCache []*Element[T]
-	cacheValid  bool
+	// Change observers
+	observers []func(events []ChangeEvent[T])
+	capture   *changeCapture[T]
+
+	// Running transaction, if any
+	tx *txJournal[T]
+
+	// Local undo capture
+	undoRecorders []func(steps []undoStep[T])
+	undoLog       []undoStep[T]
+	undoStamps    map[undoField]*undoStamp
 }
 
 // Element represents a single element in the array
@@ -34,34 +72,54 @@ type Element[T any] struct {
 	VectorClock *VectorClock
 	Deleted     bool
 	DeleteClock *VectorClock
+	DeleteTime  Timestamp
 }
 
 // VersionedValue tracks value changes independently
 type VersionedValue[T any] struct {
 	Data        T
 	VectorClock *VectorClock
+	Timestamp   Timestamp
+	Writer      string
+
+	// Siblings holds concurrent values kept in multi-value mode, see multivalue.go
+	Siblings []*VersionedValue[T]
 }
 
 // VersionedIndex tracks position changes independently
 type VersionedIndex struct {
-	Position    float64
+	Position    Position
 	VectorClock *VectorClock
+	Timestamp   Timestamp
 }
 
 // Config holds configuration options
 type Config struct {
+	// Deprecated: positions are dense fractional keys and never need
+	// reindexing. AutoReindex, ReindexThreshold, InitialIndex and
+	// IndexSpacing are ignored.
 	AutoReindex      bool
 	ReindexThreshold float64
 	InitialIndex     float64
 	IndexSpacing     float64
-	KeepSorted       bool
-	LessFunc         func(a, b interface{}) bool
+
+	KeepSorted    bool
+	LessFunc      func(a, b interface{}) bool
+	ValueCodec    interface{}
+	ValueResolver interface{}
+	MultiValue    bool
+	ConflictLog   *ConflictLog
+	HybridClock   bool
+	ClockSource   func() time.Time
 }
 
-// VectorClock implementation for causality tracking
+// VectorClock implementation for causality tracking. A clock is a shared
+// causal context plus at most one dot on top of it, see dots.go.
 type VectorClock struct {
 	mu     sync.RWMutex
 	clocks map[string]uint64
+	dot    dot
+	owned  atomic.Bool
 }
 
 // Option is a configuration option
@@ -69,16 +127,23 @@ type Option func(*Config)
 
 // NewVectorClock creates a new vector clock
 func NewVectorClock() *VectorClock {
-	return &VectorClock{
+	vc := &VectorClock{
 		clocks: make(map[string]uint64),
 	}
+	vc.owned.Store(true)
+	return vc
 }
 
 // Increment increments the clock for a replica
 func (vc *VectorClock) Increment(replicaID string) {
 	vc.mu.Lock()
 	defer vc.mu.Unlock()
-	vc.clocks[replicaID]++
+
+	counter := vc.getLocked(replicaID) + 1
+	if vc.dot.counter > 0 && vc.dot.replica != replicaID {
+		vc.flattenLocked()
+	}
+	vc.dot = dot{replicaID, counter}
 }
 
 // Merge merges another vector clock into this one
@@ -92,11 +157,20 @@ func (vc *VectorClock) Merge(other *VectorClock) {
 	defer vc.mu.Unlock()
 	defer other.mu.RUnlock()
 
-	for replica, clock := range other.clocks {
+	if dominatesLocked(vc, other) {
+		return
+	}
+	if dominatesLocked(other, vc) {
+		vc.shareLocked(other)
+		return
+	}
+
+	vc.flattenLocked()
+	other.eachLocked(func(replica string, clock uint64) {
 		if clock > vc.clocks[replica] {
 			vc.clocks[replica] = clock
 		}
-	}
+	})
 }
 
 // After returns true if this clock is causally after other
@@ -110,23 +184,7 @@ func (vc *VectorClock) After(other *VectorClock) bool {
 	defer vc.mu.RUnlock()
 	defer other.mu.RUnlock()
 
-	hasGreater := false
-	for replica, clock := range vc.clocks {
-		if clock < other.clocks[replica] {
-			return false
-		}
-		if clock > other.clocks[replica] {
-			hasGreater = true
-		}
-	}
-
-	for replica, clock := range other.clocks {
-		if _, exists := vc.clocks[replica]; !exists && clock > 0 {
-			return false
-		}
-	}
-
-	return hasGreater
+	return dominatesLocked(vc, other) && !dominatesLocked(other, vc)
 }
 
 // Concurrent returns true if clocks are concurrent
@@ -143,15 +201,24 @@ func (vc *VectorClock) Clone() *VectorClock {
 	defer vc.mu.RUnlock()
 
 	newVC := NewVectorClock()
-	for replica, clock := range vc.clocks {
+	vc.eachLocked(func(replica string, clock uint64) {
 		newVC.clocks[replica] = clock
-	}
+	})
 	return newVC
 }
 
-// Fork creates a copy for independent tracking
+// Fork creates a copy for independent tracking. The copy shares the causal
+// context, so it costs one dot rather than one entry per replica.
 func (vc *VectorClock) Fork() *VectorClock {
-	return vc.Clone()
+	if vc == nil {
+		return nil
+	}
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	newVC := &VectorClock{}
+	newVC.shareLocked(vc)
+	return newVC
 }
 
 // GetMaxReplica returns the replica with highest ID for tiebreaking
@@ -160,26 +227,25 @@ func (vc *VectorClock) GetMaxReplica() string {
 	defer vc.mu.RUnlock()
 
 	maxReplica := ""
-	for replica := range vc.clocks {
+	vc.eachLocked(func(replica string, _ uint64) {
 		if replica > maxReplica {
 			maxReplica = replica
 		}
-	}
+	})
 	return maxReplica
 }
 
 // defaultConfig returns default configuration
 func defaultConfig() Config {
 	return Config{
-		AutoReindex:      true,
-		ReindexThreshold: 0.0001,
-		InitialIndex:     1000.0,
-		IndexSpacing:     1000.0,
-		KeepSorted:       false,
+		KeepSorted: false,
 	}
 }
 
 // WithAutoReindex enables automatic reindexing
+//
+// Deprecated: positions never run out of precision, so there is nothing to
+// reindex. The option is kept for compatibility and has no effect.
 func WithAutoReindex(threshold float64) Option {
 	return func(c *Config) {
 		c.AutoReindex = true
@@ -187,7 +253,8 @@ func WithAutoReindex(threshold float64) Option {
 	}
 }
 
-// WithAutoSort keeps array automatically sorted
+// WithAutoSort keeps array automatically sorted. The sorted order is a
+// local view over the values; positions and their clocks are left alone.
 func WithAutoSort[T any](less func(a, b T) bool) Option {
 	return func(c *Config) {
 		c.KeepSorted = true
@@ -204,12 +271,14 @@ func New[T any](replicaID string, opts ...Option) *MArrayCRDT[T] {
 		opt(&config)
 	}
 
-	return &MArrayCRDT[T]{
-		items:  make(map[string]*Element[T]),
+	ma := &MArrayCRDT[T]{
+		items:     make(map[string]*Element[T]),
 		replicaID: replicaID,
-		clock:  NewVectorClock(),
-		config: config,
+		clock:     NewVectorClock(),
+		config:    config,
 	}
+	ma.rebuildOrderLocked()
+	return ma
 }
 
 // generateUUID generates a unique identifier
@@ -222,38 +291,53 @@ func generateUUID() string {
 // Clone creates a deep copy of an element
 func (e *Element[T]) Clone() *Element[T] {
 	return &Element[T]{
-		ID: e.ID,
-		Value: &VersionedValue[T]{
-			Data:        e.Value.Data,
-			VectorClock: e.Value.VectorClock.Clone(),
-		},
-		Index: &VersionedIndex{
-			Position:    e.Index.Position,
-			VectorClock: e.Index.VectorClock.Clone(),
-		},
-		VectorClock: e.VectorClock.Clone(),
+		ID:          e.ID,
+		Value:       e.Value.clone(),
+		Index:       e.Index.clone(),
+		VectorClock: e.VectorClock.Fork(),
 		Deleted:     e.Deleted,
-		DeleteClock: e.DeleteClock.Clone(),
+		DeleteClock: e.DeleteClock.Fork(),
+		DeleteTime:  e.DeleteTime,
+	}
+}
+
+// clone copies the index and its clock
+func (vi *VersionedIndex) clone() *VersionedIndex {
+	return &VersionedIndex{
+		Position:    vi.Position,
+		VectorClock: vi.VectorClock.Fork(),
+		Timestamp:   vi.Timestamp,
 	}
 }
 
 // Push adds element to end
 func (ma *MArrayCRDT[T]) Push(value T) string {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
 
+	return ma.pushLocked(value)
+}
+
+// pushLocked implements Push (must hold lock)
+func (ma *MArrayCRDT[T]) pushLocked(value T) string {
 	id := generateUUID()
-	maxIndex := ma.findMaxIndexLocked()
+	position := ma.newPositionLocked(ma.findMaxIndexLocked(), "")
 
+	now := ma.nowLocked()
 	elem := &Element[T]{
 		ID: id,
 		Value: &VersionedValue[T]{
 			Data:        value,
 			VectorClock: ma.clock.Fork(),
+			Timestamp:   now,
+			Writer:      ma.replicaID,
 		},
 		Index: &VersionedIndex{
-			Position:    maxIndex + ma.config.IndexSpacing,
+			Position:    position,
 			VectorClock: ma.clock.Fork(),
+			Timestamp:   ma.hybridTime(now),
 		},
 		VectorClock: ma.clock.Fork(),
 	}
@@ -263,28 +347,32 @@ func (ma *MArrayCRDT[T]) Push(value T) string {
 	elem.Index.VectorClock.Increment(ma.replicaID)
 	elem.VectorClock.Increment(ma.replicaID)
 
-	ma.items[id] = elem
-	ma.invalidateCache()
-
-	if ma.config.KeepSorted {
-		ma.maintainSortLocked()
-	}
+	ma.addElementLocked(elem)
+	ma.touchLocked(OpInsert, elem)
+	ma.emitLocked(OpInsert, elem)
 
 	return id
 }
 
 // Pop removes and returns last element
 func (ma *MArrayCRDT[T]) Pop() (T, bool) {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.popLocked()
+}
 
-	sorted := ma.getSortedElementsLocked()
-	if len(sorted) == 0 {
+// popLocked implements Pop (must hold lock)
+func (ma *MArrayCRDT[T]) popLocked() (T, bool) {
+	order := ma.orderLocked()
+	last := order.at(order.len() - 1)
+	if last == nil {
 		var zero T
 		return zero, false
 	}
 
-	last := sorted[len(sorted)-1]
 	ma.deleteElementLocked(last.ID)
 
 	return last.Value.Data, true
@@ -292,16 +380,22 @@ func (ma *MArrayCRDT[T]) Pop() (T, bool) {
 
 // Shift removes and returns first element
 func (ma *MArrayCRDT[T]) Shift() (T, bool) {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.shiftLocked()
+}
 
-	sorted := ma.getSortedElementsLocked()
-	if len(sorted) == 0 {
+// shiftLocked implements Shift (must hold lock)
+func (ma *MArrayCRDT[T]) shiftLocked() (T, bool) {
+	first := ma.orderLocked().at(0)
+	if first == nil {
 		var zero T
 		return zero, false
 	}
 
-	first := sorted[0]
 	ma.deleteElementLocked(first.ID)
 
 	return first.Value.Data, true
@@ -309,21 +403,32 @@ func (ma *MArrayCRDT[T]) Shift() (T, bool) {
 
 // Unshift adds element to beginning
 func (ma *MArrayCRDT[T]) Unshift(value T) string {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
 
+	return ma.unshiftLocked(value)
+}
+
+// unshiftLocked implements Unshift (must hold lock)
+func (ma *MArrayCRDT[T]) unshiftLocked(value T) string {
 	id := generateUUID()
-	minIndex := ma.findMinIndexLocked()
+	position := ma.newPositionLocked("", ma.findMinIndexLocked())
 
+	now := ma.nowLocked()
 	elem := &Element[T]{
 		ID: id,
 		Value: &VersionedValue[T]{
 			Data:        value,
 			VectorClock: ma.clock.Fork(),
+			Timestamp:   now,
+			Writer:      ma.replicaID,
 		},
 		Index: &VersionedIndex{
-			Position:    minIndex - ma.config.IndexSpacing,
+			Position:    position,
 			VectorClock: ma.clock.Fork(),
+			Timestamp:   ma.hybridTime(now),
 		},
 		VectorClock: ma.clock.Fork(),
 	}
@@ -333,12 +438,9 @@ func (ma *MArrayCRDT[T]) Unshift(value T) string {
 	elem.Index.VectorClock.Increment(ma.replicaID)
 	elem.VectorClock.Increment(ma.replicaID)
 
-	ma.items[id] = elem
-	ma.invalidateCache()
-
-	if ma.config.KeepSorted {
-		ma.maintainSortLocked()
-	}
+	ma.addElementLocked(elem)
+	ma.touchLocked(OpInsert, elem)
+	ma.emitLocked(OpInsert, elem)
 
 	return id
 }
@@ -348,69 +450,99 @@ func (ma *MArrayCRDT[T]) Get(index int) (T, bool) {
 	ma.mu.RLock()
 	defer ma.mu.RUnlock()
 
-	sorted := ma.getSortedElementsLocked()
-	if index < 0 || index >= len(sorted) {
+	elem := ma.orderLocked().at(index)
+	if elem == nil {
 		var zero T
 		return zero, false
 	}
 
-	return sorted[index].Value.Data, true
+	return elem.Value.Data, true
 }
 
 // Set updates value of element
 func (ma *MArrayCRDT[T]) Set(id string, value T) bool {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.setLocked(id, value)
+}
 
+// setLocked implements Set (must hold lock)
+func (ma *MArrayCRDT[T]) setLocked(id string, value T) bool {
 	elem, exists := ma.items[id]
 	if !exists || elem.Deleted {
 		return false
 	}
 
+	ma.setValueLocked(elem, value)
+
+	return true
+}
+
+// setValueLocked stamps a local value change (must hold lock)
+func (ma *MArrayCRDT[T]) setValueLocked(elem *Element[T], value T) {
+	ma.touchLocked(OpSet, elem)
+
 	ma.clock.Increment(ma.replicaID)
 	elem.Value.Data = value
 	elem.Value.VectorClock = ma.clock.Fork()
 	elem.Value.VectorClock.Increment(ma.replicaID)
+	elem.Value.Timestamp = ma.nowLocked()
+	elem.Value.Writer = ma.replicaID
+	elem.Value.Siblings = nil
 	elem.VectorClock.Merge(elem.Value.VectorClock)
-
-	return true
+	ma.clock.Merge(elem.Value.VectorClock)
+	ma.emitLocked(OpSet, elem)
+	ma.reorderLocked(elem.ID)
 }
 
 // Insert adds element at specific index
 func (ma *MArrayCRDT[T]) Insert(index int, value T) string {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
 
-	sorted := ma.getSortedElementsLocked()
+	return ma.insertLocked(index, value)
+}
+
+// insertLocked implements Insert (must hold lock)
+func (ma *MArrayCRDT[T]) insertLocked(index int, value T) string {
+	order := ma.orderLocked()
 	id := generateUUID()
 
-	var position float64
-	if index <= 0 {
-		minIndex := ma.findMinIndexLocked()
-		position = minIndex - ma.config.IndexSpacing
-	} else if index >= len(sorted) {
-		maxIndex := ma.findMaxIndexLocked()
-		position = maxIndex + ma.config.IndexSpacing
-	} else {
-		// Insert between elements
-		if index == 0 {
-			position = sorted[0].Index.Position - ma.config.IndexSpacing
-		} else {
-			prev := sorted[index-1]
-			next := sorted[index]
-			position = (prev.Index.Position + next.Index.Position) / 2
-		}
+	if index < 0 {
+		index = 0
+	}
+	if index > order.len() {
+		index = order.len()
 	}
 
+	// Insert between neighbours
+	var prev, next Position
+	if index > 0 {
+		prev = order.at(index - 1).Index.Position
+	}
+	if index < order.len() {
+		next = order.at(index).Index.Position
+	}
+	position := ma.newPositionLocked(prev, next)
+
+	now := ma.nowLocked()
 	elem := &Element[T]{
 		ID: id,
 		Value: &VersionedValue[T]{
 			Data:        value,
 			VectorClock: ma.clock.Fork(),
+			Timestamp:   now,
+			Writer:      ma.replicaID,
 		},
 		Index: &VersionedIndex{
 			Position:    position,
 			VectorClock: ma.clock.Fork(),
+			Timestamp:   ma.hybridTime(now),
 		},
 		VectorClock: ma.clock.Fork(),
 	}
@@ -420,24 +552,19 @@ func (ma *MArrayCRDT[T]) Insert(index int, value T) string {
 	elem.Index.VectorClock.Increment(ma.replicaID)
 	elem.VectorClock.Increment(ma.replicaID)
 
-	ma.items[id] = elem
-	ma.invalidateCache()
-
-	if ma.config.AutoReindex {
-		ma.checkReindexLocked()
-	}
-
-	if ma.config.KeepSorted {
-		ma.maintainSortLocked()
-	}
+	ma.addElementLocked(elem)
+	ma.touchLocked(OpInsert, elem)
+	ma.emitLocked(OpInsert, elem)
 
 	return id
 }
 
 // Delete removes element by ID
 func (ma *MArrayCRDT[T]) Delete(id string) bool {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
 
 	return ma.deleteElementLocked(id)
 }
@@ -449,86 +576,85 @@ func (ma *MArrayCRDT[T]) deleteElementLocked(id string) bool {
 		return false
 	}
 
+	ma.touchLocked(OpDelete, elem)
 	ma.clock.Increment(ma.replicaID)
 	elem.Deleted = true
 	elem.DeleteClock = ma.clock.Fork()
+	elem.DeleteTime = ma.hybridNowLocked()
 	elem.DeleteClock.Increment(ma.replicaID)
 	elem.VectorClock.Merge(elem.DeleteClock)
+	ma.clock.Merge(elem.DeleteClock)
+	ma.emitLocked(OpDelete, elem)
 
-	ma.invalidateCache()
+	ma.reorderLocked(id)
 	return true
 }
 
 // Move element to specific position
 func (ma *MArrayCRDT[T]) Move(id string, toIndex int) bool {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.moveLocked(id, toIndex)
+}
 
+// moveLocked implements Move (must hold lock)
+func (ma *MArrayCRDT[T]) moveLocked(id string, toIndex int) bool {
 	elem, exists := ma.items[id]
 	if !exists {
 		return false
 	}
 
-	// IMPORTANT: Moving a deleted item resurrects it with LWW semantics
-	if elem.Deleted {
-		elem.Deleted = false
-		elem.DeleteClock = nil
+	// Find the target position between the other elements
+	order := ma.orderLocked()
+	self := order.rank(id)
+	others := order.len()
+	if self >= 0 {
+		others--
+	}
+	other := func(i int) *Element[T] {
+		if self >= 0 && i >= self {
+			i++
+		}
+		return order.at(i)
 	}
-
-	sorted := ma.getSortedElementsLocked()
 
 	// Adjust index bounds
 	if toIndex < 0 {
 		toIndex = 0
 	}
-	if toIndex >= len(sorted) {
-		toIndex = len(sorted) - 1
+	if toIndex > others {
+		toIndex = others
 	}
 
-	var newPos float64
-	if toIndex == 0 {
-		newPos = sorted[0].Index.Position - ma.config.IndexSpacing
-	} else if toIndex >= len(sorted)-1 {
-		newPos = sorted[len(sorted)-1].Index.Position + ma.config.IndexSpacing
-	} else {
-		// Find the target position between elements
-		// Account for current element position
-		targetElements := make([]*Element[T], 0)
-		for _, e := range sorted {
-			if e.ID != id {
-				targetElements = append(targetElements, e)
-			}
-		}
-
-		if toIndex > 0 && toIndex <= len(targetElements) {
-			prev := targetElements[toIndex-1]
-			next := targetElements[toIndex]
-			newPos = (prev.Index.Position + next.Index.Position) / 2
-		} else {
-			newPos = targetElements[toIndex].Index.Position - ma.config.IndexSpacing
-		}
+	var prev, next Position
+	if toIndex > 0 {
+		prev = other(toIndex - 1).Index.Position
 	}
-
-	ma.clock.Increment(ma.replicaID)
-	elem.Index.Position = newPos
-	elem.Index.VectorClock = ma.clock.Fork()
-	elem.Index.VectorClock.Increment(ma.replicaID)
-	elem.VectorClock.Merge(elem.Index.VectorClock)
-
-	ma.invalidateCache()
-
-	if ma.config.AutoReindex {
-		ma.checkReindexLocked()
+	if toIndex < others {
+		next = other(toIndex).Index.Position
 	}
+	newPos := ma.newPositionLocked(prev, next)
+
+	ma.moveToLocked(elem, newPos)
 
 	return true
 }
 
 // MoveAfter moves element after another element
 func (ma *MArrayCRDT[T]) MoveAfter(id string, afterID string) bool {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.moveAfterLocked(id, afterID)
+}
 
+// moveAfterLocked implements MoveAfter (must hold lock)
+func (ma *MArrayCRDT[T]) moveAfterLocked(id string, afterID string) bool {
 	elem, exists := ma.items[id]
 	if !exists {
 		return false
@@ -539,54 +665,37 @@ func (ma *MArrayCRDT[T]) MoveAfter(id string, afterID string) bool {
 		return false
 	}
 
-	// Resurrect if deleted
-	if elem.Deleted {
-		elem.Deleted = false
-		elem.DeleteClock = nil
-	}
-
 	// Find next element after target
-	sorted := ma.getSortedElementsLocked()
-	var next *Element[T]
-	foundAfter := false
-
-	for _, e := range sorted {
-		if foundAfter && e.ID != id {
-			next = e
-			break
-		}
-		if e.ID == afterID {
-			foundAfter = true
-		}
+	order := ma.orderLocked()
+	i := order.rank(afterID) + 1
+	next := order.at(i)
+	if next != nil && next.ID == id {
+		next = order.at(i + 1)
 	}
 
-	var newPos float64
+	var nextPos Position
 	if next != nil {
-		newPos = (after.Index.Position + next.Index.Position) / 2
-	} else {
-		newPos = after.Index.Position + ma.config.IndexSpacing
+		nextPos = next.Index.Position
 	}
+	newPos := ma.newPositionLocked(after.Index.Position, nextPos)
 
-	ma.clock.Increment(ma.replicaID)
-	elem.Index.Position = newPos
-	elem.Index.VectorClock = ma.clock.Fork()
-	elem.Index.VectorClock.Increment(ma.replicaID)
-	elem.VectorClock.Merge(elem.Index.VectorClock)
-
-	ma.invalidateCache()
-
-	if ma.config.AutoReindex {
-		ma.checkReindexLocked()
-	}
+	ma.moveToLocked(elem, newPos)
 
 	return true
 }
 
 // MoveBefore moves element before another element
 func (ma *MArrayCRDT[T]) MoveBefore(id string, beforeID string) bool {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.moveBeforeLocked(id, beforeID)
+}
 
+// moveBeforeLocked implements MoveBefore (must hold lock)
+func (ma *MArrayCRDT[T]) moveBeforeLocked(id string, beforeID string) bool {
 	elem, exists := ma.items[id]
 	if !exists {
 		return false
@@ -597,52 +706,57 @@ func (ma *MArrayCRDT[T]) MoveBefore(id string, beforeID string) bool {
 		return false
 	}
 
-	// Resurrect if deleted
-	if elem.Deleted {
-		elem.Deleted = false
-		elem.DeleteClock = nil
-	}
-
 	// Find previous element before target
-	sorted := ma.getSortedElementsLocked()
-	var prev *Element[T]
-
-	for _, e := range sorted {
-		if e.ID == beforeID {
-			break
-		}
-		if e.ID != id {
-			prev = e
-		}
+	order := ma.orderLocked()
+	i := order.rank(beforeID) - 1
+	prev := order.at(i)
+	if prev != nil && prev.ID == id {
+		prev = order.at(i - 1)
 	}
 
-	var newPos float64
+	var prevPos Position
 	if prev != nil {
-		newPos = (prev.Index.Position + before.Index.Position) / 2
-	} else {
-		newPos = before.Index.Position - ma.config.IndexSpacing
+		prevPos = prev.Index.Position
 	}
+	newPos := ma.newPositionLocked(prevPos, before.Index.Position)
+
+	ma.moveToLocked(elem, newPos)
+
+	return true
+}
+
+// moveToLocked gives elem a new position with a fresh clock (must hold lock).
+// IMPORTANT: Moving a deleted item resurrects it with LWW semantics
+func (ma *MArrayCRDT[T]) moveToLocked(elem *Element[T], position Position) {
+	ma.touchLocked(OpMove, elem)
+	elem.Deleted = false
+	elem.DeleteClock = nil
+	elem.DeleteTime = Timestamp{}
 
 	ma.clock.Increment(ma.replicaID)
-	elem.Index.Position = newPos
+	elem.Index.Position = position
 	elem.Index.VectorClock = ma.clock.Fork()
+	elem.Index.Timestamp = ma.hybridNowLocked()
 	elem.Index.VectorClock.Increment(ma.replicaID)
 	elem.VectorClock.Merge(elem.Index.VectorClock)
+	ma.clock.Merge(elem.Index.VectorClock)
+	ma.emitLocked(OpMove, elem)
 
-	ma.invalidateCache()
-
-	if ma.config.AutoReindex {
-		ma.checkReindexLocked()
-	}
-
-	return true
+	ma.reorderLocked(elem.ID)
 }
 
 // Sort array with custom comparison
 func (ma *MArrayCRDT[T]) Sort(less func(a, b T) bool) {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	ma.sortLocked(less)
+}
 
+// sortLocked implements Sort (must hold lock)
+func (ma *MArrayCRDT[T]) sortLocked(less func(a, b T) bool) {
 	elements := ma.getSortedElementsLocked()
 	if len(elements) == 0 {
 		return
@@ -655,24 +769,38 @@ func (ma *MArrayCRDT[T]) Sort(less func(a, b T) bool) {
 
 	// Update indices
 	ma.clock.Increment(ma.replicaID)
+	positions := ma.newPositionRunLocked("", "", len(elements))
+	now := ma.hybridNowLocked()
 
 	for i, elem := range elements {
-		elem.Index.Position = float64(i+1) * ma.config.IndexSpacing
+		ma.touchLocked(OpMove, elem)
+		elem.Index.Position = positions[i]
 		// Give each element a unique clock
 		elem.Index.VectorClock = ma.clock.Fork()
+		elem.Index.Timestamp = now
 		elem.Index.VectorClock.Increment(ma.replicaID)
 		elem.VectorClock.Merge(elem.Index.VectorClock)
+		ma.emitLocked(OpMove, elem)
 		ma.clock.Increment(ma.replicaID)
 	}
 
-	ma.invalidateCache()
+	for _, elem := range elements {
+		ma.reorderLocked(elem.ID)
+	}
 }
 
 // Reverse reverses the array order
 func (ma *MArrayCRDT[T]) Reverse() {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
 
+	ma.reverseLocked()
+}
+
+// reverseLocked implements Reverse (must hold lock)
+func (ma *MArrayCRDT[T]) reverseLocked() {
 	elements := ma.getSortedElementsLocked()
 	n := len(elements)
 	if n == 0 {
@@ -680,35 +808,46 @@ func (ma *MArrayCRDT[T]) Reverse() {
 	}
 
 	ma.clock.Increment(ma.replicaID)
+	positions := ma.newPositionRunLocked("", "", n)
+	now := ma.hybridNowLocked()
 
 	for i, elem := range elements {
-		elem.Index.Position = float64(n-i) * ma.config.IndexSpacing
+		ma.touchLocked(OpMove, elem)
+		elem.Index.Position = positions[n-1-i]
 		// Give each element a unique clock by incrementing for each one
 		elem.Index.VectorClock = ma.clock.Fork()
+		elem.Index.Timestamp = now
 		elem.Index.VectorClock.Increment(ma.replicaID)
 		elem.VectorClock.Merge(elem.Index.VectorClock)
+		ma.emitLocked(OpMove, elem)
 		// Increment main clock for next element
 		ma.clock.Increment(ma.replicaID)
 	}
 
-	ma.invalidateCache()
+	for _, elem := range elements {
+		ma.reorderLocked(elem.ID)
+	}
 }
 
 // Shuffle randomizes array order
 func (ma *MArrayCRDT[T]) Shuffle() {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
 
+	ma.shuffleLocked()
+}
+
+// shuffleLocked implements Shuffle (must hold lock)
+func (ma *MArrayCRDT[T]) shuffleLocked() {
 	elements := ma.getSortedElementsLocked()
 	if len(elements) == 0 {
 		return
 	}
 
 	// Generate random positions
-	indices := make([]float64, len(elements))
-	for i := range indices {
-		indices[i] = float64(i+1) * ma.config.IndexSpacing
-	}
+	indices := ma.newPositionRunLocked("", "", len(elements))
 
 	// Shuffle positions
 	r := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
@@ -717,24 +856,37 @@ func (ma *MArrayCRDT[T]) Shuffle() {
 	})
 
 	ma.clock.Increment(ma.replicaID)
+	now := ma.hybridNowLocked()
 
 	for i, elem := range elements {
+		ma.touchLocked(OpMove, elem)
 		elem.Index.Position = indices[i]
 		// Give each element a unique clock
 		elem.Index.VectorClock = ma.clock.Fork()
+		elem.Index.Timestamp = now
 		elem.Index.VectorClock.Increment(ma.replicaID)
 		elem.VectorClock.Merge(elem.Index.VectorClock)
+		ma.emitLocked(OpMove, elem)
 		ma.clock.Increment(ma.replicaID)
 	}
 
-	ma.invalidateCache()
+	for _, elem := range elements {
+		ma.reorderLocked(elem.ID)
+	}
 }
 
 // Rotate rotates array by n positions
 func (ma *MArrayCRDT[T]) Rotate(n int) {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
 
+	ma.rotateLocked(n)
+}
+
+// rotateLocked implements Rotate (must hold lock)
+func (ma *MArrayCRDT[T]) rotateLocked(n int) {
 	elements := ma.getSortedElementsLocked()
 	length := len(elements)
 	if length == 0 {
@@ -748,25 +900,39 @@ func (ma *MArrayCRDT[T]) Rotate(n int) {
 	}
 
 	ma.clock.Increment(ma.replicaID)
+	positions := ma.newPositionRunLocked("", "", length)
+	now := ma.hybridNowLocked()
 
 	for i, elem := range elements {
 		newPos := (i + n) % length
-		elem.Index.Position = float64(newPos+1) * ma.config.IndexSpacing
+		ma.touchLocked(OpMove, elem)
+		elem.Index.Position = positions[newPos]
 		// Give each element a unique clock
 		elem.Index.VectorClock = ma.clock.Fork()
+		elem.Index.Timestamp = now
 		elem.Index.VectorClock.Increment(ma.replicaID)
 		elem.VectorClock.Merge(elem.Index.VectorClock)
+		ma.emitLocked(OpMove, elem)
 		ma.clock.Increment(ma.replicaID)
 	}
 
-	ma.invalidateCache()
+	for _, elem := range elements {
+		ma.reorderLocked(elem.ID)
+	}
 }
 
 // Swap swaps two elements
 func (ma *MArrayCRDT[T]) Swap(id1, id2 string) bool {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.swapLocked(id1, id2)
+}
 
+// swapLocked implements Swap (must hold lock)
+func (ma *MArrayCRDT[T]) swapLocked(id1, id2 string) bool {
 	elem1, exists1 := ma.items[id1]
 	elem2, exists2 := ma.items[id2]
 
@@ -777,98 +943,122 @@ func (ma *MArrayCRDT[T]) Swap(id1, id2 string) bool {
 	ma.clock.Increment(ma.replicaID)
 
 	// Swap positions
+	ma.touchLocked(OpMove, elem1)
+	ma.touchLocked(OpMove, elem2)
 	elem1.Index.Position, elem2.Index.Position = elem2.Index.Position, elem1.Index.Position
 
 	// Give each element a unique clock
 	elem1.Index.VectorClock = ma.clock.Fork()
+	elem1.Index.Timestamp = ma.hybridNowLocked()
 	elem1.Index.VectorClock.Increment(ma.replicaID)
 	elem1.VectorClock.Merge(elem1.Index.VectorClock)
-	
+	ma.emitLocked(OpMove, elem1)
+
 	ma.clock.Increment(ma.replicaID)
-	
+
 	elem2.Index.VectorClock = ma.clock.Fork()
+	elem2.Index.Timestamp = ma.hybridNowLocked()
 	elem2.Index.VectorClock.Increment(ma.replicaID)
 	elem2.VectorClock.Merge(elem2.Index.VectorClock)
+	ma.clock.Merge(elem2.Index.VectorClock)
+	ma.emitLocked(OpMove, elem2)
 
-	ma.invalidateCache()
+	ma.reorderLocked(id1)
+	ma.reorderLocked(id2)
 	return true
 }
 
 // Merge merges another MArrayCRDT into this one
 func (ma *MArrayCRDT[T]) Merge(other *MArrayCRDT[T]) {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(other.replicaID)
+
+	// Remember what the other replica (and everyone it heard from) has seen
+	ma.observePeerLocked(other.replicaID, other.clock)
+	for replica, vc := range other.peerClocks {
+		ma.observePeerLocked(replica, vc)
+	}
+	ma.mergeMembersLocked(other.members)
+	ma.mergeMarksLocked(other.marks)
+	stable := ma.stableClockLocked()
+	anchors := ma.markAnchorsLocked()
 
 	for id, remoteElem := range other.items {
 		localElem, exists := ma.items[id]
 
 		if !exists {
+			// Tombstones behind the horizon have been compacted here
+			if ma.collectableLocked(remoteElem, ma.gcHorizon) && !anchors[id] {
+				continue
+			}
+
 			// New element - just copy it
-			ma.items[id] = remoteElem.Clone()
+			ma.addElementLocked(forkElement(remoteElem, ma.replicaID))
+			ma.observeElementTimeLocked(remoteElem)
 			ma.clock.Merge(remoteElem.VectorClock)
-			ma.invalidateCache()
+			ma.applyPendingLocked(id, stable)
 			continue
 		}
 
 		// FIXED: Properly handle delete vs move/edit conflicts with LWW
+		ma.observeElementTimeLocked(remoteElem)
 		ma.mergeElementWithLWW(localElem, remoteElem)
 
 		// Update overall clock
 		localElem.VectorClock.Merge(remoteElem.VectorClock)
 		ma.clock.Merge(remoteElem.VectorClock)
 	}
-
-	if ma.config.KeepSorted {
-		ma.maintainSortLocked()
-	}
 }
 
 // mergeElementWithLWW merges elements using Last-Writer-Wins semantics
 func (ma *MArrayCRDT[T]) mergeElementWithLWW(local, remote *Element[T]) {
-	// First, merge Value (edit) operations independently
-	if remote.Value.VectorClock.After(local.Value.VectorClock) {
+	// First, merge Value (edit) operations independently. Nested CRDT values
+	// merge recursively instead of picking a winner.
+	if nested, ok := mergeableOf(local.Value.Data); ok {
+		mergeNestedValue(nested, local, remote)
+	} else if ma.config.MultiValue {
+		if local.Value.VectorClock.Concurrent(remote.Value.VectorClock) && !sameClock(local.Value.VectorClock, remote.Value.VectorClock) {
+			ma.logConflictLocked(local, FieldValue,
+				ConflictCandidate{"local", local.Value.VectorClock, local.Value.Timestamp},
+				ConflictCandidate{"remote", remote.Value.VectorClock, remote.Value.Timestamp}, "both", RuleSiblings)
+		}
+		local.Value = mergeSiblings(local.Value, remote.Value)
+	} else if remote.Value.VectorClock.After(local.Value.VectorClock) {
 		local.Value = &VersionedValue[T]{
 			Data:        remote.Value.Data,
-			VectorClock: remote.Value.VectorClock.Clone(),
+			VectorClock: remote.Value.VectorClock.Fork(),
+			Timestamp:   remote.Value.Timestamp,
+			Writer:      remote.Value.Writer,
 		}
 	} else if local.Value.VectorClock.Concurrent(remote.Value.VectorClock) {
-		if remote.Value.VectorClock.GetMaxReplica() > local.Value.VectorClock.GetMaxReplica() {
-			local.Value = &VersionedValue[T]{
-				Data:        remote.Value.Data,
-				VectorClock: remote.Value.VectorClock.Clone(),
-			}
+		// Concurrent edits are settled by the configured resolver
+		resolved := ma.resolveValueLocked(local.Value, remote.Value)
+		if resolved != local.Value {
+			ma.logValueConflictLocked(local, local.Value, remote.Value, resolved)
 		}
+		local.Value = resolved
 	}
 
 	// Second, merge Index (move) operations independently
 	if remote.Index.VectorClock.After(local.Index.VectorClock) {
-		local.Index = &VersionedIndex{
-			Position:    remote.Index.Position,
-			VectorClock: remote.Index.VectorClock.Clone(),
-		}
-		ma.invalidateCache()
+		local.Index = remote.Index.clone()
 	} else if local.Index.VectorClock.Concurrent(remote.Index.VectorClock) {
-		// For concurrent operations, use deterministic tiebreaker
-		// Always pick the same winner regardless of merge direction
-		remoteMaxReplica := remote.Index.VectorClock.GetMaxReplica()
-		localMaxReplica := local.Index.VectorClock.GetMaxReplica()
-		
-		// Pick winner based on replica ID comparison
-		if remoteMaxReplica > localMaxReplica {
-			local.Index = &VersionedIndex{
-				Position:    remote.Index.Position,
-				VectorClock: remote.Index.VectorClock.Clone(),
-			}
-			ma.invalidateCache()
-		} else if remoteMaxReplica == localMaxReplica {
-			// If replicas are equal, use position as tiebreaker for determinism
-			if remote.Index.Position < local.Index.Position {
-				local.Index = &VersionedIndex{
-					Position:    remote.Index.Position,
-					VectorClock: remote.Index.VectorClock.Clone(),
-				}
-				ma.invalidateCache()
-			}
+		// Concurrent moves are settled by a total order, so every replica
+		// picks the same winner whatever order the moves arrive in
+		localIndex := local.Index
+		winner := "local"
+		remoteWins, rule := ma.laterLocked(remote.Index.VectorClock, remote.Index.Timestamp, local.Index.VectorClock, local.Index.Timestamp)
+		if remoteWins {
+			local.Index = remote.Index.clone()
+			winner = "remote"
+		}
+
+		if !sameClock(localIndex.VectorClock, remote.Index.VectorClock) {
+			ma.logConflictLocked(local, FieldIndex,
+				ConflictCandidate{"local", localIndex.VectorClock, localIndex.Timestamp},
+				ConflictCandidate{"remote", remote.Index.VectorClock, remote.Index.Timestamp}, winner, rule)
 		}
 	}
 
@@ -877,15 +1067,43 @@ func (ma *MArrayCRDT[T]) mergeElementWithLWW(local, remote *Element[T]) {
 
 	// Update delete clock if needed
 	if local.Deleted {
-		if remote.Deleted && remote.DeleteClock != nil {
-			if local.DeleteClock == nil || remote.DeleteClock.After(local.DeleteClock) {
-				local.DeleteClock = remote.DeleteClock.Clone()
-			}
+		// Keep the latest delete under the same order, or a later move could
+		// beat the delete that was kept but not the one that won
+		if remote.Deleted && remote.DeleteClock != nil && ma.laterDeleteLocked(remote, local) {
+			local.DeleteClock = remote.DeleteClock.Fork()
+			local.DeleteTime = remote.DeleteTime
 		}
 	} else {
 		// Item is alive - clear delete clock
 		local.DeleteClock = nil
+		local.DeleteTime = Timestamp{}
+	}
+
+	ma.reorderLocked(local.ID)
+}
+
+// laterLocked reports whether the change stamped a wins over the concurrent
+// change stamped b, and the rule that decided. Hybrid timestamps decide first
+// under WithHybridClock, then compareReplicaOrder, so ties never depend on the
+// order in which changes arrive. (must hold lock)
+func (ma *MArrayCRDT[T]) laterLocked(aClock *VectorClock, aTime Timestamp, bClock *VectorClock, bTime Timestamp) (bool, ConflictRule) {
+	if order := aTime.Compare(bTime); ma.config.HybridClock && order != 0 {
+		return order > 0, RuleTimestamp
 	}
+	return compareReplicaOrder(aClock, bClock) > 0, replicaRule(aClock, bClock)
+}
+
+// laterDeleteLocked reports whether the delete of a supersedes the delete
+// held by b (must hold lock)
+func (ma *MArrayCRDT[T]) laterDeleteLocked(a, b *Element[T]) bool {
+	switch {
+	case b.DeleteClock == nil || a.DeleteClock.After(b.DeleteClock):
+		return true
+	case b.DeleteClock.After(a.DeleteClock):
+		return false
+	}
+	later, _ := ma.laterLocked(a.DeleteClock, a.DeleteTime, b.DeleteClock, b.DeleteTime)
+	return later
 }
 
 // resolveDeleteStatusLWW determines delete status using Last-Writer-Wins
@@ -893,6 +1111,7 @@ func (ma *MArrayCRDT[T]) resolveDeleteStatusLWW(local, remote *Element[T]) bool
 	// Collect all relevant timestamps
 	type Operation struct {
 		Clock    *VectorClock
+		Time     Timestamp
 		IsDelete bool
 		Source   string
 	}
@@ -903,6 +1122,7 @@ func (ma *MArrayCRDT[T]) resolveDeleteStatusLWW(local, remote *Element[T]) bool
 	if local.DeleteClock != nil {
 		operations = append(operations, Operation{
 			Clock:    local.DeleteClock,
+			Time:     local.DeleteTime,
 			IsDelete: true,
 			Source:   "local-delete",
 		})
@@ -911,6 +1131,7 @@ func (ma *MArrayCRDT[T]) resolveDeleteStatusLWW(local, remote *Element[T]) bool
 	if remote.DeleteClock != nil {
 		operations = append(operations, Operation{
 			Clock:    remote.DeleteClock,
+			Time:     remote.DeleteTime,
 			IsDelete: true,
 			Source:   "remote-delete",
 		})
@@ -921,6 +1142,7 @@ func (ma *MArrayCRDT[T]) resolveDeleteStatusLWW(local, remote *Element[T]) bool
 	if local.Index != nil && local.Index.VectorClock != nil {
 		operations = append(operations, Operation{
 			Clock:    local.Index.VectorClock,
+			Time:     local.Index.Timestamp,
 			IsDelete: false,
 			Source:   "local-move",
 		})
@@ -930,6 +1152,7 @@ func (ma *MArrayCRDT[T]) resolveDeleteStatusLWW(local, remote *Element[T]) bool
 	if remote.Index != nil && remote.Index.VectorClock != nil {
 		operations = append(operations, Operation{
 			Clock:    remote.Index.VectorClock,
+			Time:     remote.Index.Timestamp,
 			IsDelete: false,
 			Source:   "remote-move",
 		})
@@ -946,17 +1169,36 @@ func (ma *MArrayCRDT[T]) resolveDeleteStatusLWW(local, remote *Element[T]) bool
 
 		if op.Clock.After(latestOp.Clock) {
 			latestOp = op
-		} else if latestOp.Clock.After(op.Clock) {
-			// Keep current latest
-		} else {
-			// Concurrent - use tiebreaker
-			// For concurrent operations, prefer the deterministic replica ID ordering
-			if op.Clock.GetMaxReplica() > latestOp.Clock.GetMaxReplica() {
+		} else if !latestOp.Clock.After(op.Clock) {
+			// Concurrent - use the same total order as moves
+			if later, _ := ma.laterLocked(op.Clock, op.Time, latestOp.Clock, latestOp.Time); later {
 				latestOp = op
 			}
 		}
 	}
 
+	// Record a delete and a move that raced, if the tiebreak settled it
+	if latestOp != nil {
+		for i := range operations {
+			op := &operations[i]
+			if op.IsDelete == latestOp.IsDelete || !op.Clock.Concurrent(latestOp.Clock) || sameClock(op.Clock, latestOp.Clock) {
+				continue
+			}
+			_, rule := ma.laterLocked(op.Clock, op.Time, latestOp.Clock, latestOp.Time)
+			// The index is merged first, so a local move may be the remote one
+			source := func(op *Operation) string {
+				if !op.IsDelete && sameClock(op.Clock, remote.Index.VectorClock) {
+					return "remote-move"
+				}
+				return op.Source
+			}
+			ma.logConflictLocked(local, FieldDelete,
+				ConflictCandidate{source(latestOp), latestOp.Clock, latestOp.Time},
+				ConflictCandidate{source(op), op.Clock, op.Time}, source(latestOp), rule)
+			break
+		}
+	}
+
 	// Return whether the latest operation was a delete
 	if latestOp != nil {
 		return latestOp.IsDelete
@@ -971,16 +1213,31 @@ func (ma *MArrayCRDT[T]) Clone() *MArrayCRDT[T] {
 	ma.mu.RLock()
 	defer ma.mu.RUnlock()
 
+	return ma.forkLocked(ma.replicaID)
+}
+
+// forkLocked implements Clone and Fork (must hold lock)
+func (ma *MArrayCRDT[T]) forkLocked(replicaID string) *MArrayCRDT[T] {
 	newArray := &MArrayCRDT[T]{
-		items:  make(map[string]*Element[T]),
-		replicaID: ma.replicaID,
-		clock:  ma.clock.Clone(),
-		config: ma.config,
+		items:     make(map[string]*Element[T]),
+		replicaID: replicaID,
+		clock:     ma.clock.Clone(),
+		config:    ma.config,
+		hlc:       ma.hlc,
+	}
+	if ma.gcHorizon != nil {
+		newArray.gcHorizon = ma.gcHorizon.Clone()
 	}
 
 	for id, elem := range ma.items {
-		newArray.items[id] = elem.Clone()
+		newArray.items[id] = forkElement(elem, replicaID)
+	}
+	for replica, vc := range ma.peerClocks {
+		newArray.observePeerLocked(replica, vc)
 	}
+	newArray.mergeMembersLocked(ma.members)
+	newArray.mergeMarksLocked(ma.marks)
+	newArray.rebuildOrderLocked()
 
 	return newArray
 }
@@ -990,200 +1247,98 @@ func (ma *MArrayCRDT[T]) Len() int {
 	ma.mu.RLock()
 	defer ma.mu.RUnlock()
 
-	count := 0
-	for _, elem := range ma.items {
-		if !elem.Deleted {
-			count++
-		}
-	}
-	return count
+	return ma.orderLocked().len()
 }
 
 // ToSlice returns array as slice
 func (ma *MArrayCRDT[T]) ToSlice() []T {
-	ma.mu.RLock()
-	defer ma.mu.RUnlock()
-
-	sorted := ma.getSortedElementsLocked()
-	result := make([]T, 0, len(sorted))
-
-	for _, elem := range sorted {
-		result = append(result, elem.Value.Data)
-	}
-
-	return result
+	return ma.rootView().ToSlice()
 }
 
 // IDs returns all element IDs in order
 func (ma *MArrayCRDT[T]) IDs() []string {
-	ma.mu.RLock()
-	defer ma.mu.RUnlock()
-
-	sorted := ma.getSortedElementsLocked()
-	result := make([]string, 0, len(sorted))
-
-	for _, elem := range sorted {
-		result = append(result, elem.ID)
-	}
-
-	return result
+	return ma.rootView().IDs()
 }
 
 // Clear removes all elements
 func (ma *MArrayCRDT[T]) Clear() {
+	defer ma.flushOps()
 	ma.mu.Lock()
 	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	ma.clearLocked()
+}
 
+// clearLocked implements Clear (must hold lock)
+func (ma *MArrayCRDT[T]) clearLocked() {
 	ma.clock.Increment(ma.replicaID)
 	clock := ma.clock.Fork()
 	clock.Increment(ma.replicaID)
+	ma.clock.Merge(clock)
 
 	for _, elem := range ma.items {
 		if !elem.Deleted {
+			ma.touchLocked(OpDelete, elem)
 			elem.Deleted = true
-			elem.DeleteClock = clock.Clone()
+			elem.DeleteClock = clock.Fork()
+			elem.DeleteTime = ma.hybridNowLocked()
 			elem.VectorClock.Merge(clock)
+			ma.emitLocked(OpDelete, elem)
+			ma.reorderLocked(elem.ID)
 		}
 	}
-
-	ma.invalidateCache()
 }
 
 // Helper methods (internal, must hold lock)
 
 func (ma *MArrayCRDT[T]) getSortedElementsLocked() []*Element[T] {
-	if ma.cacheValid {
-		return ma.sortedCache
-	}
-
-	elements := make([]*Element[T], 0, len(ma.items))
-	for _, elem := range ma.items {
-		if !elem.Deleted {
-			elements = append(elements, elem)
-		}
-	}
-
-	sort.Slice(elements, func(i, j int) bool {
-		// First compare by position
-		if elements[i].Index.Position != elements[j].Index.Position {
-			return elements[i].Index.Position < elements[j].Index.Position
-		}
-		// If positions are equal, use UUID as tiebreaker for deterministic ordering
-		return elements[i].ID < elements[j].ID
+	order := ma.orderLocked()
+	elements := make([]*Element[T], 0, order.len())
+	order.each(func(elem *Element[T]) {
+		elements = append(elements, elem)
 	})
 
-	ma.sortedCache = elements
-	ma.cacheValid = true
-
 	return elements
 }
 
-func (ma *MArrayCRDT[T]) invalidateCache() {
-	ma.cacheValid = false
-}
-
-func (ma *MArrayCRDT[T]) findMaxIndexLocked() float64 {
-	if len(ma.items) == 0 {
-		return ma.config.InitialIndex
+// findMaxIndexLocked returns the largest live position, or "" if empty
+func (ma *MArrayCRDT[T]) findMaxIndexLocked() Position {
+	if !ma.config.KeepSorted {
+		order := ma.orderLocked()
+		if last := order.at(order.len() - 1); last != nil {
+			return last.Index.Position
+		}
+		return ""
 	}
 
-	maxIndex := -math.MaxFloat64
+	var maxIndex Position
 	for _, elem := range ma.items {
 		if !elem.Deleted && elem.Index.Position > maxIndex {
 			maxIndex = elem.Index.Position
 		}
 	}
-
-	if maxIndex == -math.MaxFloat64 {
-		return ma.config.InitialIndex
-	}
-
 	return maxIndex
 }
 
-func (ma *MArrayCRDT[T]) findMinIndexLocked() float64 {
-	if len(ma.items) == 0 {
-		return ma.config.InitialIndex
+// findMinIndexLocked returns the smallest live position, or "" if empty
+func (ma *MArrayCRDT[T]) findMinIndexLocked() Position {
+	if !ma.config.KeepSorted {
+		if first := ma.orderLocked().at(0); first != nil {
+			return first.Index.Position
+		}
+		return ""
 	}
 
-	minIndex := math.MaxFloat64
+	var minIndex Position
 	for _, elem := range ma.items {
-		if !elem.Deleted && elem.Index.Position < minIndex {
+		if !elem.Deleted && (minIndex == "" || elem.Index.Position < minIndex) {
 			minIndex = elem.Index.Position
 		}
 	}
-
-	if minIndex == math.MaxFloat64 {
-		return ma.config.InitialIndex
-	}
-
 	return minIndex
 }
 
-func (ma *MArrayCRDT[T]) checkReindexLocked() {
-	if !ma.config.AutoReindex {
-		return
-	}
-
-	sorted := ma.getSortedElementsLocked()
-	if len(sorted) < 2 {
-		return
-	}
-
-	needsReindex := false
-	for i := 1; i < len(sorted); i++ {
-		diff := sorted[i].Index.Position - sorted[i-1].Index.Position
-		if diff < ma.config.ReindexThreshold {
-			needsReindex = true
-			break
-		}
-	}
-
-	if needsReindex {
-		ma.reindexLocked()
-	}
-}
-
-func (ma *MArrayCRDT[T]) reindexLocked() {
-	sorted := ma.getSortedElementsLocked()
-
-	ma.clock.Increment(ma.replicaID)
-	clock := ma.clock.Fork()
-	clock.Increment(ma.replicaID)
-
-	for i, elem := range sorted {
-		elem.Index.Position = float64(i+1) * ma.config.IndexSpacing
-		elem.Index.VectorClock = clock.Clone()
-		elem.VectorClock.Merge(clock)
-	}
-
-	ma.invalidateCache()
-}
-
-func (ma *MArrayCRDT[T]) maintainSortLocked() {
-	if !ma.config.KeepSorted || ma.config.LessFunc == nil {
-		return
-	}
-
-	elements := ma.getSortedElementsLocked()
-
-	sort.Slice(elements, func(i, j int) bool {
-		return ma.config.LessFunc(elements[i].Value.Data, elements[j].Value.Data)
-	})
-
-	ma.clock.Increment(ma.replicaID)
-	clock := ma.clock.Fork()
-	clock.Increment(ma.replicaID)
-
-	for i, elem := range elements {
-		elem.Index.Position = float64(i+1) * ma.config.IndexSpacing
-		elem.Index.VectorClock = clock.Clone()
-		elem.VectorClock.Merge(clock)
-	}
-
-	ma.invalidateCache()
-}
-
 // GetElement returns the full element by ID (for debugging)
 func (ma *MArrayCRDT[T]) GetElement(id string) (*Element[T], bool) {
 	ma.mu.RLock()
@@ -1194,19 +1349,14 @@ func (ma *MArrayCRDT[T]) GetElement(id string) (*Element[T], bool) {
 		return nil, false
 	}
 
-	return elem.Clone(), true
+	return forkElement(elem, ma.replicaID), true
 }
 
 // String returns a string representation
 func (ma *MArrayCRDT[T]) String() string {
-	ma.mu.RLock()
-	defer ma.mu.RUnlock()
-
-	sorted := ma.getSortedElementsLocked()
-	values := make([]string, 0, len(sorted))
-
-	for _, elem := range sorted {
-		values = append(values, fmt.Sprintf("%v", elem.Value.Data))
+	values := make([]string, 0)
+	for _, value := range ma.ToSlice() {
+		values = append(values, fmt.Sprintf("%v", value))
 	}
 
 	return fmt.Sprintf("[%v]", values)
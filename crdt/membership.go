@@ -0,0 +1,198 @@
+package marraycrdt
+
+import "sort"
+
+// Membership
+//
+// Replicas announce themselves with Join and are retired with Leave. The
+// membership table is CRDT metadata: each entry keeps the clock of its latest
+// join or leave, a causally later change wins and a concurrent join and leave
+// resolve to joined, so a replica that rejoins is never excluded by a stale
+// eviction.
+//
+// Membership changes are counted by a clock of their own rather than the
+// replica clock, so they never show up in element clocks or hold back the
+// stable clock. The table is small and travels whole: with Merge, in every
+// DeltaSince, as OpJoin and OpLeave operations and in both encodings.
+//
+// Replicas that have left no longer hold back the stable clock used by
+// Compact. A replica must not come back with state from before its Leave;
+// it should Join again with a fresh replica ID or after a full Merge.
+
+// member is the replicated membership entry of one replica
+type member struct {
+	Active bool
+	Clock  *VectorClock
+}
+
+// PeerInfo describes another replica as seen from this one
+type PeerInfo struct {
+	ReplicaID string
+	// Active is false once the replica has left
+	Active bool
+	// Joined reports whether the replica announced itself with Join; peers
+	// also become known by appearing in a clock or being merged directly
+	Joined bool
+	// LastSeen is the latest clock known to have been seen by the peer, or
+	// nil if nothing has been learned about it yet
+	LastSeen *VectorClock
+	// Lag counts the events this replica has seen that the peer has not
+	Lag uint64
+}
+
+// Join announces this replica as an active member
+func (ma *MArrayCRDT[T]) Join() {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	ma.setMemberLocked(ma.replicaID, true)
+}
+
+// Leave marks replicaID as departed. A replica may leave itself or retire a
+// peer that is known to be gone for good.
+func (ma *MArrayCRDT[T]) Leave(replicaID string) {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	ma.setMemberLocked(replicaID, false)
+}
+
+// setMemberLocked stamps a new membership entry (must hold lock)
+func (ma *MArrayCRDT[T]) setMemberLocked(replicaID string, active bool) {
+	if ma.members == nil {
+		ma.members = make(map[string]*member)
+	}
+	if ma.memberClock == nil {
+		ma.memberClock = NewVectorClock()
+	}
+
+	ma.memberClock.Increment(ma.replicaID)
+	m := &member{
+		Active: active,
+		Clock:  ma.memberClock.Clone(),
+	}
+	ma.members[replicaID] = m
+	ma.emitMemberLocked(replicaID, m)
+}
+
+// mergeMembersLocked folds in a remote membership table (must hold lock)
+func (ma *MArrayCRDT[T]) mergeMembersLocked(remote map[string]*member) {
+	for replicaID, rm := range remote {
+		if ma.members == nil {
+			ma.members = make(map[string]*member)
+		}
+		if ma.memberClock == nil {
+			ma.memberClock = NewVectorClock()
+		}
+
+		local, exists := ma.members[replicaID]
+		switch {
+		case !exists || rm.Clock.After(local.Clock):
+			ma.members[replicaID] = &member{Active: rm.Active, Clock: rm.Clock.Clone()}
+		case local.Clock.Concurrent(rm.Clock):
+			// Join wins over a concurrent leave
+			local.Active = local.Active || rm.Active
+			local.Clock.Merge(rm.Clock)
+		}
+		ma.memberClock.Merge(rm.Clock)
+	}
+}
+
+// emitMemberLocked queues the operation for a membership entry (must hold
+// lock). Nothing is recorded without registered handlers.
+func (ma *MArrayCRDT[T]) emitMemberLocked(replicaID string, m *member) {
+	if len(ma.opHandlers) == 0 {
+		return
+	}
+
+	op := Operation[T]{
+		Type:   OpLeave,
+		ID:     replicaID,
+		Origin: ma.replicaID,
+		Clock:  m.Clock.toMap(),
+	}
+	if m.Active {
+		op.Type = OpJoin
+	}
+	ma.outbox = append(ma.outbox, op)
+}
+
+// sortedMembersLocked returns the replica IDs of the membership table in
+// order (must hold lock)
+func (ma *MArrayCRDT[T]) sortedMembersLocked() []string {
+	replicas := make([]string, 0, len(ma.members))
+	for replica := range ma.members {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+	return replicas
+}
+
+// IsActive reports whether replicaID is a participant that has not left
+func (ma *MArrayCRDT[T]) IsActive(replicaID string) bool {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return ma.isActiveLocked(replicaID)
+}
+
+func (ma *MArrayCRDT[T]) isActiveLocked(replicaID string) bool {
+	m, ok := ma.members[replicaID]
+	return !ok || m.Active
+}
+
+// joinedLocked reports whether replicaID has joined and not left (must hold lock)
+func (ma *MArrayCRDT[T]) joinedLocked(replicaID string) bool {
+	m, ok := ma.members[replicaID]
+	return ok && m.Active
+}
+
+// Peers lists every other replica known to this one, sorted by ID, with the
+// latest clock it is known to have seen and how far it lags behind
+func (ma *MArrayCRDT[T]) Peers() []PeerInfo {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	own := ma.clock.toMap()
+
+	known := make(map[string]bool)
+	for replica := range own {
+		known[replica] = true
+	}
+	for replica := range ma.peerClocks {
+		known[replica] = true
+	}
+	for replica := range ma.members {
+		known[replica] = true
+	}
+	delete(known, ma.replicaID)
+
+	peers := make([]PeerInfo, 0, len(known))
+	for replica := range known {
+		info := PeerInfo{
+			ReplicaID: replica,
+			Active:    ma.isActiveLocked(replica),
+		}
+		if m, ok := ma.members[replica]; ok {
+			info.Joined = m.Active
+		}
+
+		var seen map[string]uint64
+		if vc, ok := ma.peerClocks[replica]; ok {
+			info.LastSeen = vc.Clone()
+			seen = vc.toMap()
+		}
+		for entry, counter := range own {
+			if counter > seen[entry] {
+				info.Lag += counter - seen[entry]
+			}
+		}
+
+		peers = append(peers, info)
+	}
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ReplicaID < peers[j].ReplicaID })
+	return peers
+}
@@ -0,0 +1,173 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestMembershipReplicates tests that join and leave travel through Merge
+func TestMembershipReplicates(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	replica3 := New[string]("site3")
+
+	replica1.Join()
+	replica2.Join()
+	replica3.Join()
+	syncAll(replica1, replica2, replica3)
+
+	replica1.Leave("site3")
+	syncAll(replica1, replica2)
+
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if r.IsActive("site3") {
+			t.Errorf("%s: site3 should have left", r.replicaID)
+		}
+		if !r.IsActive("replica1") || !r.IsActive("site2") {
+			t.Errorf("%s: remaining members should be active", r.replicaID)
+		}
+	}
+
+	var ids []string
+	for _, p := range replica2.Peers() {
+		ids = append(ids, p.ReplicaID)
+	}
+	if !reflect.DeepEqual(ids, []string{"replica1", "site3"}) {
+		t.Errorf("Expected peers [replica1 site3], got %v", ids)
+	}
+}
+
+// TestConcurrentJoinWinsOverLeave tests that a concurrent rejoin is not lost
+func TestConcurrentJoinWinsOverLeave(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	replica2.Join()
+	replica1.Merge(replica2)
+
+	replica1.Leave("site2")
+	replica2.Join()
+
+	syncAll(replica1, replica2)
+
+	if !replica1.IsActive("site2") || !replica2.IsActive("site2") {
+		t.Errorf("Concurrent join should win over leave")
+	}
+
+	// A later leave still applies
+	replica1.Leave("site2")
+	replica2.Merge(replica1)
+	if replica2.IsActive("site2") {
+		t.Errorf("Causally later leave should win")
+	}
+}
+
+// TestPeersReportLag tests that lag counts events a peer has not seen
+func TestPeersReportLag(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	_ = replica1.Push("A")
+	replica1.Merge(replica2)
+	replica2.Merge(replica1)
+	replica1.Merge(replica2)
+
+	peers := replica1.Peers()
+	if len(peers) != 1 || peers[0].ReplicaID != "site2" {
+		t.Fatalf("Expected site2 as only peer, got %+v", peers)
+	}
+	if peers[0].Lag != 0 {
+		t.Errorf("Expected no lag after sync, got %d", peers[0].Lag)
+	}
+
+	_ = replica1.Push("B")
+	_ = replica1.Push("C")
+
+	peers = replica1.Peers()
+	if peers[0].Lag != 2 {
+		t.Errorf("Expected lag 2, got %d", peers[0].Lag)
+	}
+	if peers[0].LastSeen == nil || peers[0].LastSeen.toMap()["replica1"] != 1 {
+		t.Errorf("Expected last seen replica1:1, got %v", peers[0].LastSeen)
+	}
+}
+
+// TestLeftReplicaDoesNotBlockCompact tests that a departed replica stops pinning the stable clock
+func TestLeftReplicaDoesNotBlockCompact(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	replica3 := New[string]("site3")
+	joinAll(replica1, replica2, replica3)
+
+	_ = replica1.Push("A")
+	idB := replica1.Push("B")
+	syncAll(replica1, replica2, replica3)
+
+	replica1.Delete(idB)
+	syncAll(replica1, replica2)
+	syncAll(replica1, replica2)
+
+	// site3 never saw the delete
+	if n := replica1.Compact(); n != 0 {
+		t.Fatalf("Compacted %d tombstones while site3 was still a member", n)
+	}
+
+	replica1.Leave("site3")
+	syncAll(replica1, replica2)
+	syncAll(replica1, replica2)
+
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if n := r.Compact(); n != 1 {
+			t.Errorf("%s: expected 1 compacted tombstone after site3 left, got %d", r.replicaID, n)
+		}
+	}
+}
+
+// TestMembershipTravelsWithOpsDeltasAndEncodings tests that replicas syncing without Merge learn the membership table
+func TestMembershipTravelsWithOpsDeltasAndEncodings(t *testing.T) {
+	replica1 := New[string]("replica1")
+	ops := collectOps(replica1)
+
+	_ = replica1.Push("A")
+	before := replica1.Clock()
+	replica1.Join()
+	replica1.Leave("site3")
+
+	if !replica1.Clock().Dominates(before) || !before.Dominates(replica1.Clock()) {
+		t.Errorf("Membership changes must not advance the replica clock: %v", replica1.Clock())
+	}
+
+	viaOps := New[string]("site2")
+	if err := viaOps.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	viaDelta := New[string]("site4")
+	viaDelta.Merge(replica1)
+	replica1.Join()
+	viaDelta.MergeDelta(replica1.DeltaSince(viaDelta.Clock()))
+
+	viaJSON := New[string]("other")
+	data, err := json.Marshal(replica1)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	if err := json.Unmarshal(data, viaJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+
+	for _, r := range []*MArrayCRDT[string]{viaOps, viaDelta, roundTrip(t, replica1), viaJSON} {
+		if _, joined := r.members["replica1"]; !joined || !r.IsActive("replica1") {
+			t.Errorf("%s: expected replica1 to be an active member", r.replicaID)
+		}
+		if r.IsActive("site3") {
+			t.Errorf("%s: expected site3 to have left", r.replicaID)
+		}
+	}
+
+	// The latest join reached the delta replica with its clock
+	if !sameClock(viaDelta.members["replica1"].Clock, replica1.members["replica1"].Clock) {
+		t.Errorf("Delta carried a stale membership entry: %v", viaDelta.members["replica1"].Clock)
+	}
+}
@@ -0,0 +1,98 @@
+package marraycrdt
+
+import (
+	"slices"
+	"sort"
+)
+
+// Multi-value mode
+//
+// With WithMultiValue, concurrent Sets of an element are kept as siblings
+// instead of being resolved. The element's value is the version ReplicaWins
+// would pick, so Get and iteration behave as usual, and the other versions
+// hang off it as Siblings. A merge keeps every version that no other version
+// causally dominates. The conflict lasts until a replica that has seen all
+// siblings Sets the element again: that write dominates them and replaces the
+// whole set everywhere.
+//
+// Multi-value mode takes precedence over the value resolver; Mergeable values
+// still merge recursively.
+
+// WithMultiValue keeps concurrent Sets as siblings, see GetConflicts
+func WithMultiValue() Option {
+	return func(c *Config) {
+		c.MultiValue = true
+	}
+}
+
+// GetConflicts returns the concurrent values of an element with their
+// writers, ordered so that the last one is the value Get returns. It returns
+// nil if the element has a single value or does not exist.
+func (ma *MArrayCRDT[T]) GetConflicts(id string) []ValueVersion[T] {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	elem, ok := ma.items[id]
+	if !ok || len(elem.Value.Siblings) == 0 {
+		return nil
+	}
+
+	conflicts := make([]ValueVersion[T], 0, len(elem.Value.Siblings)+1)
+	for _, v := range append(slices.Clone(elem.Value.Siblings), elem.Value) {
+		version := v.version()
+		version.Clock = version.Clock.Clone()
+		conflicts = append(conflicts, version)
+	}
+	return conflicts
+}
+
+// clone copies the value, its clock and its siblings
+func (v *VersionedValue[T]) clone() *VersionedValue[T] {
+	c := &VersionedValue[T]{
+		Data:        v.Data,
+		VectorClock: v.VectorClock.Fork(),
+		Timestamp:   v.Timestamp,
+		Writer:      v.Writer,
+	}
+	for _, sibling := range v.Siblings {
+		c.Siblings = append(c.Siblings, sibling.clone())
+	}
+	return c
+}
+
+// mergeSiblings returns the versions of local and remote that no other
+// version dominates, with the ReplicaWins winner on top
+func mergeSiblings[T any](local, remote *VersionedValue[T]) *VersionedValue[T] {
+	candidates := slices.Concat([]*VersionedValue[T]{local}, local.Siblings, []*VersionedValue[T]{remote}, remote.Siblings)
+
+	var kept []*VersionedValue[T]
+	for _, v := range candidates {
+		dominated := slices.ContainsFunc(candidates, func(w *VersionedValue[T]) bool {
+			return w.VectorClock.After(v.VectorClock)
+		})
+		duplicate := slices.ContainsFunc(kept, func(k *VersionedValue[T]) bool {
+			return sameClock(k.VectorClock, v.VectorClock)
+		})
+		if !dominated && !duplicate {
+			kept = append(kept, v)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return compareReplicaOrder(kept[i].VectorClock, kept[j].VectorClock) < 0
+	})
+
+	copies := make([]*VersionedValue[T], len(kept))
+	for i, v := range kept {
+		copies[i] = &VersionedValue[T]{
+			Data:        v.Data,
+			VectorClock: v.VectorClock.Fork(),
+			Timestamp:   v.Timestamp,
+			Writer:      v.Writer,
+		}
+	}
+	merged := copies[len(copies)-1]
+	if len(copies) > 1 {
+		merged.Siblings = slices.Clip(copies[:len(copies)-1])
+	}
+	return merged
+}
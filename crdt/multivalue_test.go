@@ -0,0 +1,116 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// conflictSummary returns the writer and value of every sibling
+func conflictSummary[T any](conflicts []ValueVersion[T]) map[string]T {
+	summary := make(map[string]T, len(conflicts))
+	for _, c := range conflicts {
+		summary[c.Writer] = c.Value
+	}
+	return summary
+}
+
+// TestMultiValueKeepsSiblings tests that concurrent Sets are kept and a later Set resolves them
+func TestMultiValueKeepsSiblings(t *testing.T) {
+	replica1 := New[string]("replica1", WithMultiValue())
+	replica2 := New[string]("site2", WithMultiValue())
+
+	id := replica1.Push("Draft")
+	replica2.Merge(replica1)
+	if replica1.GetConflicts(id) != nil {
+		t.Fatalf("A single value should not be a conflict")
+	}
+
+	replica1.Set(id, "Launch plan")
+	replica2.Set(id, "Q3 launch")
+	syncAll(replica1, replica2)
+
+	expected := map[string]string{"replica1": "Launch plan", "site2": "Q3 launch"}
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if summary := conflictSummary(r.GetConflicts(id)); !reflect.DeepEqual(summary, expected) {
+			t.Errorf("%s: expected %v, got %v", r.replicaID, expected, summary)
+		}
+	}
+	conflicts := replica1.GetConflicts(id)
+	if value, _ := replica1.Get(0); value != conflicts[len(conflicts)-1].Value {
+		t.Errorf("Get should return the last sibling, got %v", value)
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+
+	// Picking a title after seeing both resolves the conflict everywhere
+	replica2.Set(id, "Q3 launch plan")
+	replica1.Merge(replica2)
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if conflicts := r.GetConflicts(id); conflicts != nil {
+			t.Errorf("%s: conflict should be resolved, got %v", r.replicaID, conflictSummary(conflicts))
+		}
+		if value, _ := r.Get(0); value != "Q3 launch plan" {
+			t.Errorf("%s: expected the resolving Set, got %v", r.replicaID, value)
+		}
+	}
+}
+
+// TestMultiValueThreeReplicas tests siblings across ops, partial syncs and both encodings
+func TestMultiValueThreeReplicas(t *testing.T) {
+	replica1 := New[string]("replica1", WithMultiValue())
+	replica2 := New[string]("site2", WithMultiValue())
+	replica3 := New[string]("site3", WithMultiValue())
+	ops := collectOps(replica2)
+
+	id := replica1.Push("Draft")
+	syncAll(replica1, replica2, replica3)
+
+	replica1.Set(id, "A")
+	replica2.Set(id, "B")
+	replica3.Set(id, "C")
+
+	// replica1 hears from site2 through ops and from site3 through site3's merge with site2
+	if err := replica1.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	replica3.Merge(replica2)
+	replica1.Merge(replica3)
+
+	expected := map[string]string{"replica1": "A", "site2": "B", "site3": "C"}
+	if summary := conflictSummary(replica1.GetConflicts(id)); !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("Expected %v, got %v", expected, summary)
+	}
+
+	data, err := replica1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	fromBinary := New[string]("other", WithMultiValue())
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	data, err = json.Marshal(replica1)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	fromJSON := New[string]("other", WithMultiValue())
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+
+	for _, decoded := range []*MArrayCRDT[string]{fromBinary, fromJSON} {
+		if !reflect.DeepEqual(decoded.GetConflicts(id), replica1.GetConflicts(id)) {
+			t.Errorf("Round trip changed the siblings: %v", conflictSummary(decoded.GetConflicts(id)))
+		}
+	}
+
+	// A Set that has seen only some siblings leaves the others in place
+	replica2.Set(id, "B2")
+	replica1.Merge(replica2)
+	expected = map[string]string{"replica1": "A", "site2": "B2", "site3": "C"}
+	if summary := conflictSummary(replica1.GetConflicts(id)); !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected %v, got %v", expected, summary)
+	}
+}
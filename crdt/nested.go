@@ -0,0 +1,512 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Nested CRDTs
+//
+// A value that implements Mergeable is a CRDT itself: a Counter, a Map or a
+// nested MArrayCRDT. Concurrent changes to such a value are merged
+// recursively instead of one side winning, so two replicas editing different
+// fields of the same card both keep their edit. Set on a Mergeable value
+// therefore merges with concurrent versions rather than replacing them.
+//
+// Edit a nested value through Update, which stamps the element so the change
+// is picked up by DeltaSince, emitted as an operation and observed. Every
+// replica edits its own copy: values are forked to the receiving replica's ID
+// whenever they enter a replica, so nested clocks never mix up two writers.
+// Create new nested values with the replica ID of the array holding them.
+//
+// Undo restores the previous value only on this replica; the next merge
+// brings back what the undone edit added, because Mergeable values only
+// grow by merging.
+
+// Mergeable is implemented by values that are CRDTs themselves
+type Mergeable[T any] interface {
+	// Merge folds other into the value without modifying other
+	Merge(other T)
+	// Fork returns an independent deep copy that makes its own edits as
+	// replicaID
+	Fork(replicaID string) T
+}
+
+// Update replaces the value of an element with fn(value). It is meant for
+// values that are edited in place, such as nested CRDTs.
+func (ma *MArrayCRDT[T]) Update(id string, fn func(value T) T) bool {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.updateLocked(id, fn)
+}
+
+// updateLocked implements Update (must hold lock)
+func (ma *MArrayCRDT[T]) updateLocked(id string, fn func(value T) T) bool {
+	elem, exists := ma.items[id]
+	if !exists || elem.Deleted {
+		return false
+	}
+
+	ma.touchLocked(OpSet, elem)
+	ma.setValueLocked(elem, fn(elem.Value.Data))
+
+	return true
+}
+
+// Fork returns a deep copy of the array that makes its own edits as replicaID.
+// A new replicaID is registered as a member first (see gc.go), so this
+// replica does not compact anything the copy still holds before hearing from
+// it.
+func (ma *MArrayCRDT[T]) Fork(replicaID string) *MArrayCRDT[T] {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	if replicaID != ma.replicaID {
+		ma.setMemberLocked(replicaID, true)
+	}
+	return ma.forkLocked(replicaID)
+}
+
+// forkValue is Fork for a nested array that moves into another replica; the
+// copy stands for the same replica, so no member is registered
+func (ma *MArrayCRDT[T]) forkValue(replicaID string) *MArrayCRDT[T] {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return ma.forkLocked(replicaID)
+}
+
+// mergeableOf returns v as a Mergeable if it is one and not a nil pointer
+func mergeableOf[T any](v T) (Mergeable[T], bool) {
+	m, ok := any(v).(Mergeable[T])
+	if !ok {
+		return nil, false
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, false
+	}
+	return m, true
+}
+
+// forkValue returns a copy of a Mergeable value owned by replicaID. Other
+// values are returned as they are.
+func forkValue[T any](v T, replicaID string) T {
+	if m, ok := mergeableOf(v); ok {
+		// A nested array keeps its membership, see MArrayCRDT.forkValue
+		if nested, ok := any(v).(interface{ forkValue(replicaID string) T }); ok {
+			return nested.forkValue(replicaID)
+		}
+		return m.Fork(replicaID)
+	}
+	return v
+}
+
+// forkElement returns a copy of elem whose nested value is owned by replicaID
+func forkElement[T any](elem *Element[T], replicaID string) *Element[T] {
+	c := elem.Clone()
+	c.Value.Data = forkValue(c.Value.Data, replicaID)
+	return c
+}
+
+// mergeNestedValue merges the remote version of a Mergeable value into the
+// local one and combines their clocks
+func mergeNestedValue[T any](nested Mergeable[T], local, remote *Element[T]) {
+	if local.Value.VectorClock.Dominates(remote.Value.VectorClock) {
+		return
+	}
+	if _, ok := mergeableOf(remote.Value.Data); ok {
+		nested.Merge(remote.Value.Data)
+	}
+
+	clock := local.Value.VectorClock.Clone()
+	clock.Merge(remote.Value.VectorClock)
+	local.Value = &VersionedValue[T]{
+		Data:        local.Value.Data,
+		VectorClock: clock,
+		Timestamp:   laterTimestamp(local.Value.Timestamp, remote.Value.Timestamp),
+	}
+}
+
+// Counter is a CRDT counter that supports increments and decrements
+type Counter struct {
+	mu        sync.RWMutex
+	replicaID string
+	inc       map[string]uint64
+	dec       map[string]uint64
+}
+
+// NewCounter creates a counter at zero
+func NewCounter(replicaID string) *Counter {
+	return &Counter{
+		replicaID: replicaID,
+		inc:       make(map[string]uint64),
+		dec:       make(map[string]uint64),
+	}
+}
+
+// Add adds delta, which may be negative
+func (c *Counter) Add(delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if delta >= 0 {
+		c.inc[c.replicaID] += uint64(delta)
+	} else {
+		c.dec[c.replicaID] += uint64(-delta)
+	}
+}
+
+// Value returns the current count
+func (c *Counter) Value() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var total int64
+	for _, n := range c.inc {
+		total += int64(n)
+	}
+	for _, n := range c.dec {
+		total -= int64(n)
+	}
+	return total
+}
+
+// Merge takes the larger count of every replica
+func (c *Counter) Merge(other *Counter) {
+	if other == c {
+		return
+	}
+	remote := other.Fork(other.replicaID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for replica, n := range remote.inc {
+		c.inc[replica] = max(c.inc[replica], n)
+	}
+	for replica, n := range remote.dec {
+		c.dec[replica] = max(c.dec[replica], n)
+	}
+}
+
+// Fork returns a copy of the counter that counts as replicaID
+func (c *Counter) Fork(replicaID string) *Counter {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	fork := NewCounter(replicaID)
+	for replica, n := range c.inc {
+		fork.inc[replica] = n
+	}
+	for replica, n := range c.dec {
+		fork.dec[replica] = n
+	}
+	return fork
+}
+
+// counterJSON is the wire form of a Counter
+type counterJSON struct {
+	ReplicaID string            `json:"replicaId"`
+	Inc       map[string]uint64 `json:"inc"`
+	Dec       map[string]uint64 `json:"dec"`
+}
+
+// MarshalJSON encodes the per-replica counts
+func (c *Counter) MarshalJSON() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return json.Marshal(counterJSON{ReplicaID: c.replicaID, Inc: c.inc, Dec: c.dec})
+}
+
+// UnmarshalJSON replaces the counter with the decoded one
+func (c *Counter) UnmarshalJSON(data []byte) error {
+	var doc counterJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	decoded := NewCounter(doc.ReplicaID)
+	for replica, n := range doc.Inc {
+		decoded.inc[replica] = n
+	}
+	for replica, n := range doc.Dec {
+		decoded.dec[replica] = n
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replicaID, c.inc, c.dec = decoded.replicaID, decoded.inc, decoded.dec
+	return nil
+}
+
+// MarshalBinary encodes the counter as replicaID followed by the increment
+// and decrement tables, each a count of (replica, count) pairs
+func (c *Counter) MarshalBinary() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	w := &binWriter{}
+	w.string(c.replicaID)
+	for _, table := range []map[string]uint64{c.inc, c.dec} {
+		replicas := make([]string, 0, len(table))
+		for replica := range table {
+			replicas = append(replicas, replica)
+		}
+		sort.Strings(replicas)
+
+		w.uvarint(uint64(len(replicas)))
+		for _, replica := range replicas {
+			w.string(replica)
+			w.uvarint(table[replica])
+		}
+	}
+	return w.buf, nil
+}
+
+// UnmarshalBinary replaces the counter with one produced by MarshalBinary
+func (c *Counter) UnmarshalBinary(data []byte) error {
+	r := &binReader{data: data}
+	decoded := NewCounter(r.string())
+	for _, table := range []map[string]uint64{decoded.inc, decoded.dec} {
+		n := r.count()
+		for i := 0; i < n && r.err == nil; i++ {
+			replica := r.string()
+			table[replica] = r.uvarint()
+		}
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos != len(data) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidEncoding, len(data)-r.pos)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replicaID, c.inc, c.dec = decoded.replicaID, decoded.inc, decoded.dec
+	return nil
+}
+
+// Map is a CRDT map from string keys to values. Every key is a register:
+// a causally later write wins and concurrent writes are ordered by the sum of
+// their clocks, then by writer. Mergeable values of concurrent writes are
+// merged instead, like the values of an MArrayCRDT.
+type Map[V any] struct {
+	mu        sync.RWMutex
+	replicaID string
+	clock     *VectorClock
+	entries   map[string]*mapEntry[V]
+}
+
+// mapEntry is the latest write of one key; deletes are kept as tombstones
+type mapEntry[V any] struct {
+	Value   V            `json:"value"`
+	Clock   *VectorClock `json:"clock"`
+	Writer  string       `json:"writer"`
+	Deleted bool         `json:"deleted,omitempty"`
+}
+
+// NewMap creates an empty map
+func NewMap[V any](replicaID string) *Map[V] {
+	return &Map[V]{
+		replicaID: replicaID,
+		clock:     NewVectorClock(),
+		entries:   make(map[string]*mapEntry[V]),
+	}
+}
+
+// Set writes value under key
+func (m *Map[V]) Set(key string, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.writeLocked(key, value, false)
+}
+
+// Delete removes key
+func (m *Map[V]) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[key]; ok && !entry.Deleted {
+		var zero V
+		m.writeLocked(key, zero, true)
+	}
+}
+
+// writeLocked stamps a local write of key (must hold lock)
+func (m *Map[V]) writeLocked(key string, value V, deleted bool) {
+	m.clock.Increment(m.replicaID)
+	m.entries[key] = &mapEntry[V]{
+		Value:   value,
+		Clock:   m.clock.Fork(),
+		Writer:  m.replicaID,
+		Deleted: deleted,
+	}
+}
+
+// Get returns the value under key
+func (m *Map[V]) Get(key string) (V, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if entry, ok := m.entries[key]; ok && !entry.Deleted {
+		return entry.Value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Keys returns the present keys in sorted order
+func (m *Map[V]) Keys() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.entries))
+	for key, entry := range m.entries {
+		if !entry.Deleted {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of present keys
+func (m *Map[V]) Len() int {
+	return len(m.Keys())
+}
+
+// Merge folds in the writes of another map
+func (m *Map[V]) Merge(other *Map[V]) {
+	if other == m {
+		return
+	}
+	// Copy first so two maps merging into each other cannot deadlock
+	remoteMap := other.Fork(m.replicaID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, remote := range remoteMap.entries {
+		local, exists := m.entries[key]
+		if !exists {
+			m.entries[key] = remote
+			continue
+		}
+		if local.Clock.Dominates(remote.Clock) {
+			continue
+		}
+
+		if nested, ok := mergeableOf(local.Value); ok && !local.Deleted && !remote.Deleted {
+			if _, ok := mergeableOf(remote.Value); ok {
+				nested.Merge(remote.Value)
+			}
+			local.Clock.Merge(remote.Clock)
+			continue
+		}
+		if remote.Clock.Dominates(local.Clock) || laterWrite(remote, local) {
+			m.entries[key] = remote
+		}
+	}
+	m.clock.Merge(remoteMap.clock)
+}
+
+// laterWrite orders concurrent writes by clock sum, then by writer
+func laterWrite[V any](a, b *mapEntry[V]) bool {
+	sumA, sumB := clockSum(a.Clock), clockSum(b.Clock)
+	if sumA != sumB {
+		return sumA > sumB
+	}
+	return a.Writer > b.Writer
+}
+
+// clockSum returns the total number of events in a clock
+func clockSum(vc *VectorClock) uint64 {
+	var sum uint64
+	for _, counter := range vc.toMap() {
+		sum += counter
+	}
+	return sum
+}
+
+// fork copies the entry for replicaID
+func (e *mapEntry[V]) fork(replicaID string) *mapEntry[V] {
+	return &mapEntry[V]{
+		Value:   forkValue(e.Value, replicaID),
+		Clock:   e.Clock.Clone(),
+		Writer:  e.Writer,
+		Deleted: e.Deleted,
+	}
+}
+
+// Fork returns a deep copy of the map that writes as replicaID
+func (m *Map[V]) Fork(replicaID string) *Map[V] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	fork := NewMap[V](replicaID)
+	fork.clock = m.clock.Clone()
+	for key, entry := range m.entries {
+		fork.entries[key] = entry.fork(replicaID)
+	}
+	return fork
+}
+
+// mapJSON is the wire form of a Map
+type mapJSON[V any] struct {
+	ReplicaID string                  `json:"replicaId"`
+	Clock     *VectorClock            `json:"clock"`
+	Entries   map[string]*mapEntry[V] `json:"entries"`
+}
+
+// MarshalJSON encodes every entry, tombstones included
+func (m *Map[V]) MarshalJSON() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return json.Marshal(mapJSON[V]{ReplicaID: m.replicaID, Clock: m.clock, Entries: m.entries})
+}
+
+// UnmarshalJSON replaces the map with the decoded one
+func (m *Map[V]) UnmarshalJSON(data []byte) error {
+	var doc mapJSON[V]
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Entries == nil {
+		doc.Entries = make(map[string]*mapEntry[V])
+	}
+	for key, entry := range doc.Entries {
+		if entry == nil || entry.Clock == nil {
+			return fmt.Errorf("%w: map entry %q without clock", ErrInvalidEncoding, key)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replicaID = doc.ReplicaID
+	m.clock = orEmptyClock(doc.Clock)
+	m.entries = doc.Entries
+	return nil
+}
+
+// MarshalBinary encodes the map as its JSON document, so it can be the value
+// of an MArrayCRDT encoded with DefaultCodec
+func (m *Map[V]) MarshalBinary() ([]byte, error) {
+	return m.MarshalJSON()
+}
+
+// UnmarshalBinary replaces the map with one produced by MarshalBinary
+func (m *Map[V]) UnmarshalBinary(data []byte) error {
+	return m.UnmarshalJSON(data)
+}
@@ -0,0 +1,172 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// cardFields returns the fields of a card as a plain map
+func cardFields(card *Map[string]) map[string]string {
+	fields := make(map[string]string)
+	for _, key := range card.Keys() {
+		fields[key], _ = card.Get(key)
+	}
+	return fields
+}
+
+// TestNestedMapMergesFields tests that concurrent edits of different card fields both survive
+func TestNestedMapMergesFields(t *testing.T) {
+	replica1 := New[*Map[string]]("replica1")
+	replica2 := New[*Map[string]]("site2")
+
+	card := NewMap[string]("replica1")
+	card.Set("title", "Draft")
+	card.Set("owner", "nobody")
+	id := replica1.Push(card)
+	replica2.Merge(replica1)
+
+	replica1.Update(id, func(c *Map[string]) *Map[string] {
+		c.Set("title", "Final")
+		return c
+	})
+	replica2.Update(id, func(c *Map[string]) *Map[string] {
+		c.Set("owner", "bob")
+		c.Delete("due")
+		return c
+	})
+	// Concurrent writes of the same field resolve the same way everywhere
+	replica1.Update(id, func(c *Map[string]) *Map[string] { c.Set("color", "red"); return c })
+	replica2.Update(id, func(c *Map[string]) *Map[string] { c.Set("color", "blue"); return c })
+
+	syncAll(replica1, replica2)
+
+	card1, _ := replica1.Get(0)
+	card2, _ := replica2.Get(0)
+	if card1 == card2 {
+		t.Fatalf("Replicas share the nested value")
+	}
+	if !reflect.DeepEqual(cardFields(card1), cardFields(card2)) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", cardFields(card1), cardFields(card2))
+	}
+	fields := cardFields(card1)
+	if fields["title"] != "Final" || fields["owner"] != "bob" {
+		t.Errorf("An edit was lost: %v", fields)
+	}
+}
+
+// TestNestedBoard tests a board of columns holding cards with delta and op sync
+func TestNestedBoard(t *testing.T) {
+	replica1 := New[*MArrayCRDT[string]]("replica1")
+	replica2 := New[*MArrayCRDT[string]]("site2")
+	ops := collectOps(replica1)
+
+	todo := New[string]("replica1")
+	todo.Push("write tests")
+	todoID := replica1.Push(todo)
+	doneID := replica1.Push(New[string]("replica1"))
+	if err := replica2.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Both replicas add a card to the same column, and one reorders the columns
+	since := replica2.Clock()
+	replica1.Update(todoID, func(column *MArrayCRDT[string]) *MArrayCRDT[string] {
+		column.Push("review")
+		return column
+	})
+	replica2.Update(todoID, func(column *MArrayCRDT[string]) *MArrayCRDT[string] {
+		column.Unshift("plan")
+		return column
+	})
+	replica2.MoveBefore(doneID, todoID)
+
+	replica2.MergeDelta(replica1.DeltaSince(since))
+	replica1.Merge(replica2)
+
+	for _, r := range []*MArrayCRDT[*MArrayCRDT[string]]{replica1, replica2} {
+		column, _ := r.Get(1)
+		if !reflect.DeepEqual(column.ToSlice(), []string{"plan", "write tests", "review"}) {
+			t.Errorf("%s: unexpected column %v", r.replicaID, column.ToSlice())
+		}
+		if r.IDs()[0] != doneID {
+			t.Errorf("%s: columns were not reordered", r.replicaID)
+		}
+	}
+
+	// Every replica edits its own copy under its own ID
+	column, _ := replica2.Get(1)
+	if column.replicaID != "site2" {
+		t.Errorf("Nested array should be owned by site2, got %s", column.replicaID)
+	}
+}
+
+// TestNestedCounterAndEncoding tests counters and nested values through both encodings
+func TestNestedCounterAndEncoding(t *testing.T) {
+	replica1 := New[*Counter]("replica1")
+	replica2 := New[*Counter]("site2")
+
+	id := replica1.Push(NewCounter("replica1"))
+	replica2.Merge(replica1)
+	for i := 0; i < 3; i++ {
+		replica1.Update(id, func(c *Counter) *Counter { c.Add(2); return c })
+		replica2.Update(id, func(c *Counter) *Counter { c.Add(-1); return c })
+	}
+	syncAll(replica1, replica2)
+
+	for _, r := range []*MArrayCRDT[*Counter]{replica1, replica2} {
+		if counter, _ := r.Get(0); counter.Value() != 3 {
+			t.Errorf("%s: expected 3, got %d", r.replicaID, counter.Value())
+		}
+	}
+
+	data, err := replica1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	decoded := New[*Counter]("other")
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if counter, _ := decoded.Get(0); counter.Value() != 3 {
+		t.Errorf("Binary round trip lost the count: %d", counter.Value())
+	}
+
+	cards := New[*Map[string]]("replica1")
+	card := NewMap[string]("replica1")
+	card.Set("title", "A")
+	card.Set("gone", "x")
+	card.Delete("gone")
+	cards.Push(card)
+
+	data, err = json.Marshal(cards)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	fromJSON := New[*Map[string]]("other")
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if decodedCard, _ := fromJSON.Get(0); !reflect.DeepEqual(cardFields(decodedCard), map[string]string{"title": "A"}) {
+		t.Errorf("JSON round trip changed the card: %v", cardFields(decodedCard))
+	}
+}
+
+// TestNestedUpdateRollsBack tests that a failed transaction restores a nested value
+func TestNestedUpdateRollsBack(t *testing.T) {
+	replica1 := New[*Counter]("replica1")
+	id := replica1.Push(NewCounter("replica1"))
+
+	failure := errors.New("abort")
+	err := replica1.Transact(func(tx *Tx[*Counter]) error {
+		tx.Update(id, func(c *Counter) *Counter { c.Add(5); return c })
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the transaction error, got %v", err)
+	}
+	if counter, _ := replica1.Get(0); counter.Value() != 0 {
+		t.Errorf("Rollback should restore the counter, got %d", counter.Value())
+	}
+}
@@ -0,0 +1,221 @@
+package marraycrdt
+
+import "sort"
+
+// ChangeKind identifies what happened to an element in a ChangeEvent
+type ChangeKind string
+
+const (
+	// ChangeInserted reports a new live element
+	ChangeInserted ChangeKind = "inserted"
+	// ChangeDeleted reports a live element that became a tombstone
+	ChangeDeleted ChangeKind = "deleted"
+	// ChangeValueUpdated reports a new value for a live element
+	ChangeValueUpdated ChangeKind = "value-updated"
+	// ChangeMoved reports a new position for a live element
+	ChangeMoved ChangeKind = "moved"
+	// ChangeResurrected reports a tombstone that became live again
+	ChangeResurrected ChangeKind = "resurrected"
+	// ChangeFormatted reports a new mark covering a live element
+	ChangeFormatted ChangeKind = "formatted"
+)
+
+// ChangeEvent describes one visible change of the array.
+//
+// OldIndex and NewIndex are positions in the live array before and after the
+// change, or -1 where the element was not live. An element whose value and
+// position both changed produces two events. A new mark produces one
+// ChangeFormatted event per live element it covers, attributed to the
+// replica that added the mark.
+type ChangeEvent[T any] struct {
+	Kind     ChangeKind
+	ID       string
+	OldIndex int
+	NewIndex int
+	Value    T
+	// Origin is the replica that made the change: this replica for local
+	// mutators, the merged replica for Merge and the operation origin for Apply
+	Origin string
+	Local  bool
+}
+
+// Observe registers a handler that receives the changes made by every local
+// mutator, Merge, MergeDelta and Apply, one batch per call. Calls that change
+// nothing visible produce no batch. Handlers run after the array lock has
+// been released.
+func (ma *MArrayCRDT[T]) Observe(handler func(events []ChangeEvent[T])) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	ma.observers = append(ma.observers, handler)
+}
+
+// changeCapture records the elements touched by a change. The order tree
+// is persistent, so the root taken when the change started still describes
+// the order before it.
+type changeCapture[T any] struct {
+	origin  string
+	origins map[string]string
+	root    *orderNode[T]
+	touched map[string]touchedElement[T]
+	marks   []*Mark
+}
+
+// touchedElement is the state of an element before its first change
+type touchedElement[T any] struct {
+	// node is the order node of a live element, nil otherwise
+	node    *orderNode[T]
+	existed bool
+}
+
+// beginChangeLocked starts recording changes for observers (must hold lock).
+// Nested calls keep the outermost capture.
+func (ma *MArrayCRDT[T]) beginChangeLocked(origin string) {
+	if len(ma.observers) == 0 || ma.capture != nil {
+		return
+	}
+
+	ma.capture = &changeCapture[T]{
+		origin:  origin,
+		root:    ma.orderLocked().root,
+		touched: make(map[string]touchedElement[T]),
+	}
+}
+
+// noteChangeLocked records the state of an element before its first change
+// (must hold lock). Later calls for the same element are ignored.
+func (ma *MArrayCRDT[T]) noteChangeLocked(id string) {
+	if ma.capture == nil {
+		return
+	}
+	if _, ok := ma.capture.touched[id]; ok {
+		return
+	}
+
+	_, existed := ma.items[id]
+	ma.capture.touched[id] = touchedElement[T]{node: ma.orderLocked().nodes[id], existed: existed}
+}
+
+// noteOriginLocked attributes changes of one element to origin (must hold lock)
+func (ma *MArrayCRDT[T]) noteOriginLocked(id, origin string) {
+	if ma.capture == nil {
+		return
+	}
+	if ma.capture.origins == nil {
+		ma.capture.origins = make(map[string]string)
+	}
+	ma.capture.origins[id] = origin
+}
+
+// noteMarkLocked records a mark added by the change (must hold lock)
+func (ma *MArrayCRDT[T]) noteMarkLocked(mark *Mark) {
+	if ma.capture == nil {
+		return
+	}
+	ma.capture.marks = append(ma.capture.marks, mark)
+}
+
+// endChangeLocked turns the elements recorded since beginChangeLocked into
+// events (must hold lock). Indices are rank lookups in the order trees
+// before and after the change, so the cost follows the number of touched
+// elements rather than the array size.
+func (ma *MArrayCRDT[T]) endChangeLocked() []ChangeEvent[T] {
+	capture := ma.capture
+	ma.capture = nil
+	if capture == nil {
+		return nil
+	}
+
+	var events []ChangeEvent[T]
+	// source names the element or mark whose origin the event takes
+	eventFrom := func(source string, kind ChangeKind, id string, oldIndex, newIndex int, value T) {
+		origin := capture.origin
+		if o, ok := capture.origins[source]; ok {
+			origin = o
+		}
+		events = append(events, ChangeEvent[T]{
+			Kind:     kind,
+			ID:       id,
+			OldIndex: oldIndex,
+			NewIndex: newIndex,
+			Value:    value,
+			Origin:   origin,
+			Local:    origin == ma.replicaID,
+		})
+	}
+	event := func(kind ChangeKind, id string, oldIndex, newIndex int, value T) {
+		eventFrom(id, kind, id, oldIndex, newIndex, value)
+	}
+
+	order := ma.orderLocked()
+	for id, old := range capture.touched {
+		oldIndex := -1
+		if old.node != nil {
+			oldIndex = order.rankIn(capture.root, old.node)
+		}
+		newIndex := order.rank(id)
+
+		switch {
+		case oldIndex < 0 && newIndex < 0:
+		case oldIndex < 0:
+			elem := ma.items[id]
+			if old.existed {
+				event(ChangeResurrected, id, -1, newIndex, elem.Value.Data)
+			} else {
+				event(ChangeInserted, id, -1, newIndex, elem.Value.Data)
+			}
+		case newIndex < 0:
+			event(ChangeDeleted, id, oldIndex, -1, old.node.value)
+		default:
+			elem := ma.items[id]
+			if old.node.position != elem.Index.Position {
+				event(ChangeMoved, id, oldIndex, newIndex, elem.Value.Data)
+			}
+			if old.node.valueClock != elem.Value.VectorClock && !sameClock(old.node.valueClock, elem.Value.VectorClock) {
+				event(ChangeValueUpdated, id, oldIndex, newIndex, elem.Value.Data)
+			}
+		}
+	}
+
+	for _, mark := range capture.marks {
+		from, to, ok := ma.markRangeLocked(mark)
+		if !ok {
+			continue
+		}
+		index := from
+		walkNodes(order.root, from, func(node *orderNode[T]) bool {
+			if index >= to {
+				return false
+			}
+			old := node
+			if touched, ok := capture.touched[node.id]; ok {
+				old = touched.node
+			}
+			oldIndex := -1
+			if old != nil {
+				oldIndex = order.rankIn(capture.root, old)
+			}
+			eventFrom(mark.ID, ChangeFormatted, node.id, oldIndex, index, node.elem.Value.Data)
+			index++
+			return true
+		})
+	}
+
+	// Deletions first in old order, then everything else in new order
+	sort.SliceStable(events, func(i, j int) bool {
+		di, dj := events[i].Kind == ChangeDeleted, events[j].Kind == ChangeDeleted
+		if di != dj {
+			return di
+		}
+		if di {
+			return events[i].OldIndex < events[j].OldIndex
+		}
+		return events[i].NewIndex < events[j].NewIndex
+	})
+	return events
+}
+
+// sameClock reports whether two clocks hold the same entries
+func sameClock(a, b *VectorClock) bool {
+	return a.Dominates(b) && b.Dominates(a)
+}
@@ -0,0 +1,184 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// collectEvents records every batch of change events
+func collectEvents[T any](ma *MArrayCRDT[T]) *[][]ChangeEvent[T] {
+	var batches [][]ChangeEvent[T]
+	ma.Observe(func(events []ChangeEvent[T]) {
+		batches = append(batches, events)
+	})
+	return &batches
+}
+
+// kinds flattens the kinds of one batch
+func kinds[T any](events []ChangeEvent[T]) []ChangeKind {
+	var result []ChangeKind
+	for _, e := range events {
+		result = append(result, e.Kind)
+	}
+	return result
+}
+
+// TestObserveLocalMutators tests the events produced by local changes
+func TestObserveLocalMutators(t *testing.T) {
+	replica1 := New[string]("replica1")
+	batches := collectEvents(replica1)
+
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+	replica1.Set(idA, "A2")
+	replica1.Move(idA, 1)
+	replica1.Delete(idB)
+	replica1.MoveAfter(idB, idA)
+	_, _ = replica1.Get(0)
+
+	expected := [][]ChangeKind{
+		{ChangeInserted},
+		{ChangeInserted},
+		{ChangeValueUpdated},
+		{ChangeMoved},
+		{ChangeDeleted},
+		{ChangeResurrected},
+	}
+	if len(*batches) != len(expected) {
+		t.Fatalf("Expected %d batches, got %d", len(expected), len(*batches))
+	}
+	for i, batch := range *batches {
+		if !reflect.DeepEqual(kinds(batch), expected[i]) {
+			t.Errorf("Batch %d: expected %v, got %v", i, expected[i], kinds(batch))
+		}
+		for _, e := range batch {
+			if !e.Local || e.Origin != "replica1" {
+				t.Errorf("Batch %d: expected local origin, got %q", i, e.Origin)
+			}
+		}
+	}
+
+	move := (*batches)[3][0]
+	if move.ID != idA || move.OldIndex != 0 || move.NewIndex != 1 {
+		t.Errorf("Unexpected move event %+v", move)
+	}
+	del := (*batches)[4][0]
+	if del.ID != idB || del.OldIndex != 0 || del.NewIndex != -1 || del.Value != "B" {
+		t.Errorf("Unexpected delete event %+v", del)
+	}
+}
+
+// TestObserveMerge tests that merged remote changes are reported with their origin
+func TestObserveMerge(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	_ = replica1.Push("B")
+	replica2.Merge(replica1)
+
+	batches := collectEvents(replica1)
+
+	replica2.Set(idA, "A2")
+	_ = replica2.Push("C")
+	replica2.Reverse()
+	replica1.Merge(replica2)
+
+	if len(*batches) != 1 {
+		t.Fatalf("Expected one batch for Merge, got %d", len(*batches))
+	}
+
+	counts := make(map[ChangeKind]int)
+	for _, e := range (*batches)[0] {
+		counts[e.Kind]++
+		if e.Local || e.Origin != "site2" {
+			t.Errorf("Expected remote origin site2, got %q", e.Origin)
+		}
+	}
+	if counts[ChangeInserted] != 1 || counts[ChangeValueUpdated] != 1 || counts[ChangeMoved] != 2 {
+		t.Errorf("Unexpected events %v", counts)
+	}
+
+	// Merging again changes nothing
+	replica1.Merge(replica2)
+	if len(*batches) != 1 {
+		t.Errorf("Idempotent merge should not produce events")
+	}
+}
+
+// TestObserveApply tests that applied operations carry the operation origin
+func TestObserveApply(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	ops := collectOps(replica2)
+
+	_ = replica2.Push("A")
+
+	batches := collectEvents(replica1)
+	if err := replica1.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if len(*batches) != 1 || len((*batches)[0]) != 1 {
+		t.Fatalf("Expected one insert event, got %v", *batches)
+	}
+	e := (*batches)[0][0]
+	if e.Kind != ChangeInserted || e.Origin != "site2" || e.Local || e.Value != "A" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+// TestObserveIndices tests that event indices point into the live array
+// before and after each change
+func TestObserveIndices(t *testing.T) {
+	replica1 := New[int]("replica1")
+	for i := range 20 {
+		replica1.Push(i)
+	}
+	replica2 := replica1.Fork("replica2")
+	ids := replica1.IDs()
+
+	var before []string
+	var failed bool
+	replica1.Observe(func(events []ChangeEvent[int]) {
+		after := replica1.IDs()
+		for _, e := range events {
+			if e.OldIndex >= 0 && before[e.OldIndex] != e.ID {
+				t.Errorf("Event %+v: old index holds %s", e, before[e.OldIndex])
+				failed = true
+			}
+			if e.NewIndex >= 0 && after[e.NewIndex] != e.ID {
+				t.Errorf("Event %+v: new index holds %s", e, after[e.NewIndex])
+				failed = true
+			}
+		}
+		before = after
+	})
+
+	changes := []func(){
+		func() { replica1.Delete(ids[3]) },
+		func() { replica1.Move(ids[0], 10) },
+		func() { replica1.Sort(func(a, b int) bool { return a > b }) },
+		func() { replica1.DeleteRange(2, 6) },
+		func() {
+			_ = replica1.Transact(func(tx *Tx[int]) error {
+				id := tx.Insert(4, 100)
+				tx.Delete(id)
+				tx.Set(ids[7], 70)
+				tx.Move(ids[7], 0)
+				return nil
+			})
+		},
+		func() {
+			replica2.Set(ids[3], 30)
+			replica1.Merge(replica2)
+		},
+	}
+	for _, change := range changes {
+		before = replica1.IDs()
+		change()
+		if failed {
+			break
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package marraycrdt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OpType identifies the kind of change carried by an Operation
+type OpType string
+
+const (
+	// OpInsert creates a new element with its value and position
+	OpInsert OpType = "insert"
+	// OpSet replaces the value of an element
+	OpSet OpType = "set"
+	// OpMove changes the position of an element (and resurrects it if deleted)
+	OpMove OpType = "move"
+	// OpDelete marks an element as deleted
+	OpDelete OpType = "delete"
+	// OpJoin records the replica named by ID as an active member
+	OpJoin OpType = "join"
+	// OpLeave records the replica named by ID as departed
+	OpLeave OpType = "leave"
+	// OpMark adds the formatting mark named by ID
+	OpMark OpType = "mark"
+)
+
+// Operation is a single replicated change produced by a local mutator.
+//
+// Every field is exported and the clock is a plain map, so operations can be
+// shipped with encoding/json, gob or any other encoder. An operation carries
+// the new state of exactly one field of one element together with the vector
+// clock stamped on that field, which makes Apply idempotent and lets
+// operations be applied in any order once their element exists. Inserts and
+// sets also carry the value's timestamp, and moves and deletes theirs under
+// WithHybridClock. Joins and leaves carry a membership entry instead: ID
+// names the member and Clock is the entry's membership clock. Marks carry
+// the mark in Mark, with its ID in ID and its clock in Clock.
+type Operation[T any] struct {
+	Type     OpType            `json:"type"`
+	ID       string            `json:"id"`
+	Origin   string            `json:"origin"`
+	Value    T                 `json:"value,omitempty"`
+	Position Position          `json:"position,omitempty"`
+	Clock    map[string]uint64 `json:"clock"`
+	Time     Timestamp         `json:"time"`
+	Mark     *Mark             `json:"mark,omitempty"`
+}
+
+// ErrInvalidOperation is returned by Apply for malformed operations
+var ErrInvalidOperation = errors.New("marraycrdt: invalid operation")
+
+// OnOperations registers a handler that receives the operations produced by
+// every local mutator. Each mutator call delivers its operations as a single
+// batch; Sort, Reverse and similar bulk calls produce one move per element.
+// Handlers run after the array lock has been released, so they may read from
+// or write to the array.
+func (ma *MArrayCRDT[T]) OnOperations(handler func(ops []Operation[T])) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	ma.opHandlers = append(ma.opHandlers, handler)
+}
+
+// Apply applies operations received from a remote replica.
+//
+// Operations are applied with the same LWW rules as Merge, so applying an
+// operation twice or in a different order than it was produced has no
+// additional effect. Operations that target an element whose insert has not
+// arrived yet are buffered and applied as soon as the element becomes known,
+// either through a later insert or through Merge.
+func (ma *MArrayCRDT[T]) Apply(ops ...Operation[T]) error {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked("")
+
+	for _, op := range ops {
+		if err := validateOperation(op); err != nil {
+			return err
+		}
+	}
+
+	stable := ma.stableClockLocked()
+	for _, op := range ops {
+		ma.noteOriginLocked(op.ID, op.Origin)
+		ma.applyOpLocked(op, stable)
+	}
+
+	return nil
+}
+
+// PendingOperations returns the number of buffered operations waiting for
+// their element to be inserted
+func (ma *MArrayCRDT[T]) PendingOperations() int {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	count := 0
+	for _, ops := range ma.pendingOps {
+		count += len(ops)
+	}
+	return count
+}
+
+func validateOperation[T any](op Operation[T]) error {
+	if op.ID == "" {
+		return fmt.Errorf("%w: missing element id", ErrInvalidOperation)
+	}
+	if len(op.Clock) == 0 {
+		return fmt.Errorf("%w: missing clock for %s %s", ErrInvalidOperation, op.Type, op.ID)
+	}
+	switch op.Type {
+	case OpInsert, OpSet, OpMove, OpDelete, OpJoin, OpLeave:
+		return nil
+	case OpMark:
+		if op.Mark == nil || op.Mark.Start == "" {
+			return fmt.Errorf("%w: mark %s without content", ErrInvalidOperation, op.ID)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidOperation, op.Type)
+	}
+}
+
+// applyOpLocked applies a single validated operation; stable is the stable
+// clock of the batch (must hold lock)
+func (ma *MArrayCRDT[T]) applyOpLocked(op Operation[T], stable *VectorClock) {
+	switch op.Type {
+	case OpJoin, OpLeave:
+		ma.mergeMembersLocked(map[string]*member{
+			op.ID: {Active: op.Type == OpJoin, Clock: clockFromMap(op.Clock)},
+		})
+		return
+	case OpMark:
+		mark := *op.Mark
+		mark.ID = op.ID
+		mark.Clock = clockFromMap(op.Clock)
+		ma.mergeMarksLocked(map[string]*Mark{op.ID: &mark})
+		return
+	}
+
+	if ma.opContexts == nil {
+		ma.opContexts = make(contextCache)
+	}
+	clock := ma.opContexts.clock(op.Clock, op.Origin)
+	ma.observeTimeLocked(op.Time)
+	local, exists := ma.items[op.ID]
+
+	if !exists {
+		// Everyone has seen this change, so its element was collected
+		if stable.Dominates(clock) {
+			return
+		}
+		if op.Type != OpInsert {
+			if ma.pendingOps == nil {
+				ma.pendingOps = make(map[string][]Operation[T])
+			}
+			ma.pendingOps[op.ID] = append(ma.pendingOps[op.ID], op)
+			return
+		}
+
+		ma.addElementLocked(&Element[T]{
+			ID: op.ID,
+			Value: &VersionedValue[T]{
+				Data:        forkValue(op.Value, ma.replicaID),
+				VectorClock: clock.Fork(),
+				Timestamp:   op.Time,
+				Writer:      op.Origin,
+			},
+			Index: &VersionedIndex{
+				Position:    op.Position,
+				VectorClock: clock.Fork(),
+				Timestamp:   ma.hybridTime(op.Time),
+			},
+			VectorClock: clock.Fork(),
+		})
+		ma.clock.Merge(clock)
+		ma.applyPendingLocked(op.ID, stable)
+		return
+	}
+
+	// Express the operation as a remote copy of the element that differs only
+	// in the changed field, then resolve it like any other merge
+	remote := local.Clone()
+	switch op.Type {
+	case OpInsert:
+		remote.Value = &VersionedValue[T]{Data: op.Value, VectorClock: clock.Fork(), Timestamp: op.Time, Writer: op.Origin}
+		remote.Index = &VersionedIndex{Position: op.Position, VectorClock: clock.Fork(), Timestamp: ma.hybridTime(op.Time)}
+	case OpSet:
+		remote.Value = &VersionedValue[T]{Data: op.Value, VectorClock: clock.Fork(), Timestamp: op.Time, Writer: op.Origin}
+	case OpMove:
+		remote.Index = &VersionedIndex{Position: op.Position, VectorClock: clock.Fork(), Timestamp: op.Time}
+	case OpDelete:
+		remote.Deleted = true
+		remote.DeleteClock = clock.Fork()
+		remote.DeleteTime = op.Time
+	}
+	remote.VectorClock.Merge(clock)
+
+	ma.mergeElementWithLWW(local, remote)
+	local.VectorClock.Merge(remote.VectorClock)
+	ma.clock.Merge(clock)
+}
+
+// applyPendingLocked replays buffered operations for a newly known element
+func (ma *MArrayCRDT[T]) applyPendingLocked(id string, stable *VectorClock) {
+	ops, ok := ma.pendingOps[id]
+	if !ok {
+		return
+	}
+	delete(ma.pendingOps, id)
+
+	for _, op := range ops {
+		ma.applyOpLocked(op, stable)
+	}
+}
+
+// emitLocked queues an operation describing the current state of one field
+// of elem, which a local write just changed, and stamps the undo steps of
+// that write (must hold lock). No operation is recorded without registered
+// handlers.
+func (ma *MArrayCRDT[T]) emitLocked(opType OpType, elem *Element[T]) {
+	ma.stampUndoLocked(opType, elem)
+	if len(ma.opHandlers) == 0 {
+		return
+	}
+
+	op := Operation[T]{
+		Type:   opType,
+		ID:     elem.ID,
+		Origin: ma.replicaID,
+	}
+
+	switch opType {
+	case OpInsert:
+		op.Value = forkValue(elem.Value.Data, ma.replicaID)
+		op.Position = elem.Index.Position
+		op.Clock = elem.VectorClock.toMap()
+		op.Time = elem.Value.Timestamp
+	case OpSet:
+		op.Value = forkValue(elem.Value.Data, ma.replicaID)
+		op.Clock = elem.Value.VectorClock.toMap()
+		op.Time = elem.Value.Timestamp
+	case OpMove:
+		op.Position = elem.Index.Position
+		op.Clock = elem.Index.VectorClock.toMap()
+		op.Time = elem.Index.Timestamp
+	case OpDelete:
+		op.Clock = elem.DeleteClock.toMap()
+		op.Time = elem.DeleteTime
+	}
+
+	ma.outbox = append(ma.outbox, op)
+}
+
+// flushOps delivers queued operations to the registered handlers, captured
+// undo steps to undo managers and change events to observers. Public mutators
+// defer it before taking the lock so it runs after unlocking.
+func (ma *MArrayCRDT[T]) flushOps() {
+	ma.mu.Lock()
+	ops := ma.outbox
+	ma.outbox = nil
+	handlers := ma.opHandlers
+	steps := ma.undoLog
+	ma.undoLog = nil
+	recorders := ma.undoRecorders
+	events := ma.endChangeLocked()
+	observers := ma.observers
+	ma.mu.Unlock()
+
+	if len(steps) > 0 {
+		for _, record := range recorders {
+			record(steps)
+		}
+	}
+
+	if len(events) > 0 {
+		for _, observe := range observers {
+			observe(events)
+		}
+	}
+
+	if len(ops) == 0 {
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(ops)
+	}
+}
+
+// toMap returns a plain copy of the clock entries
+func (vc *VectorClock) toMap() map[string]uint64 {
+	if vc == nil {
+		return nil
+	}
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+
+	m := make(map[string]uint64, vc.lenLocked())
+	vc.eachLocked(func(replica string, clock uint64) {
+		m[replica] = clock
+	})
+	return m
+}
+
+// clockFromMap returns a clock holding a copy of entries
+func clockFromMap(entries map[string]uint64) *VectorClock {
+	vc := NewVectorClock()
+	for replica, clock := range entries {
+		vc.clocks[replica] = clock
+	}
+	return vc
+}
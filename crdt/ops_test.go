@@ -0,0 +1,270 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// collectOps records every operation batch emitted by a replica
+func collectOps[T any](ma *MArrayCRDT[T]) *[]Operation[T] {
+	var ops []Operation[T]
+	ma.OnOperations(func(batch []Operation[T]) {
+		ops = append(ops, batch...)
+	})
+	return &ops
+}
+
+// TestOperationSyncMatchesMerge tests that op-based sync converges to the same state as Merge
+func TestOperationSyncMatchesMerge(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	ops1 := collectOps(replica1)
+	ops2 := collectOps(replica2)
+
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+	_ = replica1.Push("C")
+	idD := replica1.Push("D")
+
+	if err := replica2.Apply(*ops1...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	*ops1 = nil
+
+	if !reflect.DeepEqual(replica2.ToSlice(), []string{"A", "B", "C", "D"}) {
+		t.Fatalf("Replica2 initial state wrong: %v", replica2.ToSlice())
+	}
+
+	// Concurrent edits on both sides
+	replica1.Move(idD, 0)
+	replica1.Set(idB, "B1")
+	replica1.Delete(idA)
+	replica2.Set(idB, "B2")
+	replica2.Swap(idA, idD)
+	replica2.Reverse()
+
+	// Reference result from state-based merge
+	state1 := replica1.Clone()
+	state2 := replica2.Clone()
+	state1.Merge(state2)
+	state2.Merge(state1)
+
+	if err := replica1.Apply(*ops2...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := replica2.Apply(*ops1...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge!\nReplica1: %v\nReplica2: %v",
+			replica1.ToSlice(), replica2.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), state1.ToSlice()) {
+		t.Errorf("Op-based sync differs from Merge\nOps: %v\nMerge: %v",
+			replica1.ToSlice(), state1.ToSlice())
+	}
+}
+
+// TestApplyIdempotentAndReordered tests duplicate and out-of-order delivery
+func TestApplyIdempotentAndReordered(t *testing.T) {
+	replica1 := New[int]("replica1")
+	replica2 := New[int]("site2")
+	ops := collectOps(replica1)
+
+	ids := make([]string, 5)
+	for i := range ids {
+		ids[i] = replica1.Push(i)
+	}
+	replica1.Set(ids[2], 20)
+	replica1.Move(ids[4], 0)
+	replica1.Delete(ids[1])
+
+	// Deliver in reverse order, twice
+	for i := len(*ops) - 1; i >= 0; i-- {
+		if err := replica2.Apply((*ops)[i]); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	if err := replica2.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if replica2.PendingOperations() != 0 {
+		t.Errorf("Expected no pending operations, got %d", replica2.PendingOperations())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge!\nReplica1: %v\nReplica2: %v",
+			replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestOperationsBufferedUntilMerge tests that buffered ops are released by a state merge
+func TestOperationsBufferedUntilMerge(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	id := replica1.Push("A")
+	ops := collectOps(replica1)
+	replica1.Set(id, "A1")
+
+	if err := replica2.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if replica2.PendingOperations() != 1 {
+		t.Fatalf("Expected 1 pending operation, got %d", replica2.PendingOperations())
+	}
+
+	// Merge an older state that only contains the insert
+	stale := New[string]("replica1")
+	stale.Merge(replica1)
+	stale.items[id].Value.Data = "A"
+	stale.items[id].Value.VectorClock = stale.items[id].Index.VectorClock.Clone()
+	replica2.Merge(stale)
+
+	if replica2.PendingOperations() != 0 {
+		t.Errorf("Expected pending operations to be applied, got %d", replica2.PendingOperations())
+	}
+	if got := replica2.ToSlice(); !reflect.DeepEqual(got, []string{"A1"}) {
+		t.Errorf("Expected [A1], got %v", got)
+	}
+}
+
+// TestOperationJSONRoundTrip tests that operations survive JSON encoding
+func TestOperationJSONRoundTrip(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	ops := collectOps(replica1)
+
+	idA := replica1.Push("A")
+	_ = replica1.Push("B")
+	replica1.MoveAfter(idA, replica1.IDs()[1])
+
+	data, err := json.Marshal(*ops)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded []Operation[string]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := replica2.Apply(decoded...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(replica2.ToSlice(), []string{"B", "A"}) {
+		t.Errorf("Expected [B A], got %v", replica2.ToSlice())
+	}
+}
+
+// TestApplyRejectsInvalidOperation tests validation of malformed operations
+func TestApplyRejectsInvalidOperation(t *testing.T) {
+	replica := New[string]("replica1")
+
+	err := replica.Apply(Operation[string]{Type: "bogus", ID: "x", Clock: map[string]uint64{"a": 1}})
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Expected ErrInvalidOperation, got %v", err)
+	}
+	err = replica.Apply(Operation[string]{Type: OpSet, ID: "x"})
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Expected ErrInvalidOperation for missing clock, got %v", err)
+	}
+}
+
+// randomEdit makes one random insert, set, delete or move
+func randomEdit(rng *rand.Rand, ma *MArrayCRDT[string]) {
+	n := ma.Len()
+	ids := ma.IDs()
+	switch op := rng.Intn(4); {
+	case op == 0 || n == 0:
+		ma.Insert(rng.Intn(n+1), fmt.Sprint(rng.Intn(100)))
+	case op == 1:
+		ma.Set(ids[rng.Intn(n)], fmt.Sprint(rng.Intn(100)))
+	case op == 2:
+		ma.Delete(ids[rng.Intn(n)])
+	default:
+		ma.Move(ids[rng.Intn(n)], rng.Intn(n))
+	}
+}
+
+// TestRepeatedMoveConverges tests that a move concurrent with two causally
+// ordered moves wins or loses the same way on both sides
+func TestRepeatedMoveConverges(t *testing.T) {
+	a := New[string]("a")
+	c := New[string]("c")
+	opsA := collectOps(a)
+	opsC := collectOps(c)
+
+	c.Push("p")
+	c.Push("q")
+	x := c.Push("x")
+	if err := a.Apply(*opsC...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	*opsC = nil
+
+	a.Move(x, 1)
+	c.Move(x, 0)
+	c.Move(x, 2)
+	if err := a.Apply(*opsC...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := c.Apply(*opsA...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !reflect.DeepEqual(a.ToSlice(), c.ToSlice()) {
+		t.Errorf("Replicas diverged: a=%v c=%v", a.ToSlice(), c.ToSlice())
+	}
+}
+
+// TestRandomOperationSyncConverges tests that replicas applying each other's
+// operations in different orders end in the same state as Merge
+func TestRandomOperationSyncConverges(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		replicas := []*MArrayCRDT[string]{New[string]("a"), New[string]("b"), New[string]("c")}
+		ops := make([]*[]Operation[string], len(replicas))
+		for i, r := range replicas {
+			ops[i] = collectOps(r)
+		}
+
+		for round := 0; round < 5; round++ {
+			for _, r := range replicas {
+				for range 1 + rng.Intn(4) {
+					randomEdit(rng, r)
+				}
+			}
+
+			// Every replica applies the others' new operations in its own order
+			var batch []Operation[string]
+			for i := range ops {
+				batch = append(batch, *ops[i]...)
+				*ops[i] = nil
+			}
+			for _, r := range replicas {
+				shuffled := append([]Operation[string](nil), batch...)
+				rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+				if err := r.Apply(shuffled...); err != nil {
+					t.Fatalf("seed %d: Apply failed: %v", seed, err)
+				}
+			}
+			for i := range ops {
+				*ops[i] = nil
+			}
+		}
+
+		merged := New[string]("merged")
+		for _, r := range replicas {
+			merged.Merge(r)
+		}
+		for _, r := range replicas {
+			if !reflect.DeepEqual(r.ToSlice(), merged.ToSlice()) {
+				t.Fatalf("seed %d: %s has %v, merge has %v", seed, r.replicaID, r.ToSlice(), merged.ToSlice())
+			}
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package marraycrdt
+
+import mathrand "math/rand"
+
+// Visible order
+//
+// Live elements are kept in a treap ordered by nodeLess and augmented
+// with subtree sizes, so index to element, element to index, insert and
+// remove are all O(log n). A node remembers the sort key it was inserted
+// with because mutators change positions and values in place; reorderLocked
+// uses that snapshot to find the node again before re-inserting the element.
+// Tombstones are not in the tree.
+//
+// The treap is persistent: nodes are never modified once they are reachable
+// from a root, every update copies the O(log n) nodes on its path instead.
+// A root therefore stays a consistent view of the order it was taken from,
+// which is what Snapshot hands out.
+
+// orderNode is one live element in the order tree
+type orderNode[T any] struct {
+	elem       *Element[T]
+	id         string
+	position   Position
+	value      T
+	valueClock *VectorClock
+
+	priority    uint32
+	size        int
+	left, right *orderNode[T]
+}
+
+func (n *orderNode[T]) count() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *orderNode[T]) update() {
+	n.size = 1 + n.left.count() + n.right.count()
+}
+
+// orderTree is a treap of live elements
+type orderTree[T any] struct {
+	root  *orderNode[T]
+	nodes map[string]*orderNode[T]
+	less  func(a, b *orderNode[T]) bool
+}
+
+func newOrderTree[T any](less func(a, b *orderNode[T]) bool) *orderTree[T] {
+	return &orderTree[T]{
+		nodes: make(map[string]*orderNode[T]),
+		less:  less,
+	}
+}
+
+// insert adds elem with its current sort key
+func (t *orderTree[T]) insert(elem *Element[T]) {
+	node := &orderNode[T]{
+		elem:       elem,
+		id:         elem.ID,
+		position:   elem.Index.Position,
+		value:      elem.Value.Data,
+		valueClock: elem.Value.VectorClock,
+		priority:   mathrand.Uint32(),
+		size:       1,
+	}
+	t.nodes[elem.ID] = node
+
+	left, right := t.split(t.root, node)
+	t.root = t.join(t.join(left, node), right)
+}
+
+// remove drops the element with the given ID, if present
+func (t *orderTree[T]) remove(id string) {
+	key, ok := t.nodes[id]
+	if !ok {
+		return
+	}
+	delete(t.nodes, id)
+	t.root = t.removeNode(t.root, key)
+}
+
+func (t *orderTree[T]) removeNode(root, key *orderNode[T]) *orderNode[T] {
+	if root == nil {
+		return nil
+	}
+	if root.id == key.id {
+		return t.join(root.left, root.right)
+	}
+
+	n := *root
+	if t.less(key, root) {
+		n.left = t.removeNode(root.left, key)
+	} else {
+		n.right = t.removeNode(root.right, key)
+	}
+	n.update()
+	return &n
+}
+
+// split divides root into the nodes ordered before key and the rest
+func (t *orderTree[T]) split(root, key *orderNode[T]) (*orderNode[T], *orderNode[T]) {
+	if root == nil {
+		return nil, nil
+	}
+
+	n := *root
+	if t.less(root, key) {
+		left, right := t.split(root.right, key)
+		n.right = left
+		n.update()
+		return &n, right
+	}
+	left, right := t.split(root.left, key)
+	n.left = right
+	n.update()
+	return left, &n
+}
+
+// join concatenates two treaps where every node of a precedes every node of b
+func (t *orderTree[T]) join(a, b *orderNode[T]) *orderNode[T] {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		n := *a
+		n.right = t.join(a.right, b)
+		n.update()
+		return &n
+	}
+	n := *b
+	n.left = t.join(a, b.left)
+	n.update()
+	return &n
+}
+
+// len returns the number of live elements
+func (t *orderTree[T]) len() int {
+	return t.root.count()
+}
+
+// at returns the element at index, or nil if out of range
+func (t *orderTree[T]) at(index int) *Element[T] {
+	if node := nodeAt(t.root, index); node != nil {
+		return node.elem
+	}
+	return nil
+}
+
+// rank returns the index of the element with the given ID, or -1
+func (t *orderTree[T]) rank(id string) int {
+	key, ok := t.nodes[id]
+	if !ok {
+		return -1
+	}
+	return t.rankIn(t.root, key)
+}
+
+// rankIn returns the index of key below root, which may be an older root of
+// this tree, or -1 if key is not there
+func (t *orderTree[T]) rankIn(root, key *orderNode[T]) int {
+	rank := 0
+	node := root
+	for node != nil {
+		switch {
+		case node.id == key.id:
+			return rank + node.left.count()
+		case t.less(key, node):
+			node = node.left
+		default:
+			rank += node.left.count() + 1
+			node = node.right
+		}
+	}
+	return -1
+}
+
+// countBefore returns how many live elements are ordered before elem, which
+// may be a tombstone
+func (t *orderTree[T]) countBefore(elem *Element[T]) int {
+	key := &orderNode[T]{id: elem.ID, position: elem.Index.Position, value: elem.Value.Data}
+
+	count := 0
+	node := t.root
+	for node != nil {
+		if t.less(node, key) {
+			count += node.left.count() + 1
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return count
+}
+
+// each visits the live elements in order
+func (t *orderTree[T]) each(fn func(elem *Element[T])) {
+	walkNodes(t.root, 0, func(node *orderNode[T]) bool {
+		fn(node.elem)
+		return true
+	})
+}
+
+// nodeAt returns the node at index below root, or nil if out of range
+func nodeAt[T any](root *orderNode[T], index int) *orderNode[T] {
+	if index < 0 {
+		return nil
+	}
+
+	node := root
+	for node != nil {
+		leftSize := node.left.count()
+		switch {
+		case index < leftSize:
+			node = node.left
+		case index == leftSize:
+			return node
+		default:
+			index -= leftSize + 1
+			node = node.right
+		}
+	}
+	return nil
+}
+
+// walkNodes visits the nodes below root in order, starting at index from,
+// until fn returns false. It reports whether the walk ran to the end.
+func walkNodes[T any](root *orderNode[T], from int, fn func(node *orderNode[T]) bool) bool {
+	if root == nil {
+		return true
+	}
+
+	leftSize := root.left.count()
+	if from < leftSize {
+		if !walkNodes(root.left, from, fn) {
+			return false
+		}
+	}
+	if from <= leftSize {
+		if !fn(root) {
+			return false
+		}
+	}
+	return walkNodes(root.right, max(from-leftSize-1, 0), fn)
+}
+
+// walkNodesBackward visits the nodes below root in reverse order until fn
+// returns false. It reports whether the walk ran to the end.
+func walkNodesBackward[T any](root *orderNode[T], fn func(node *orderNode[T]) bool) bool {
+	if root == nil {
+		return true
+	}
+	return walkNodesBackward(root.right, fn) && fn(root) && walkNodesBackward(root.left, fn)
+}
+
+// orderLocked returns the order tree, building it from items if the replica
+// was assembled without one (must hold lock)
+func (ma *MArrayCRDT[T]) orderLocked() *orderTree[T] {
+	if ma.order == nil {
+		ma.rebuildOrderLocked()
+	}
+	return ma.order
+}
+
+// reorderLocked moves the element with the given ID to its current place in
+// the visible order, or takes it out if it is deleted or gone. Call it after
+// changing the position, value or delete status of an element (must hold lock).
+func (ma *MArrayCRDT[T]) reorderLocked(id string) {
+	ma.noteChangeLocked(id)
+
+	order := ma.orderLocked()
+	order.remove(id)
+	if elem, ok := ma.items[id]; ok && !elem.Deleted {
+		order.insert(elem)
+	}
+}
+
+// addElementLocked stores an element this replica did not hold and places it
+// in the visible order (must hold lock)
+func (ma *MArrayCRDT[T]) addElementLocked(elem *Element[T]) {
+	ma.noteChangeLocked(elem.ID)
+	ma.items[elem.ID] = elem
+	ma.reorderLocked(elem.ID)
+}
+
+// rebuildOrderLocked builds the order tree from scratch after items was
+// replaced (must hold lock)
+func (ma *MArrayCRDT[T]) rebuildOrderLocked() {
+	ma.order = newOrderTree(ma.nodeLess)
+	for _, elem := range ma.items {
+		if !elem.Deleted {
+			ma.order.insert(elem)
+		}
+	}
+}
+
+// nodeLess defines the visible order of live elements.
+//
+// With KeepSorted the order is derived from the values instead of rewriting
+// positions. Values converge like any other field, so every replica computes
+// the same order, and because no position or index clock is touched a local
+// re-sort can never win LWW against a concurrent move made on another
+// replica. Positions still break ties between equal values.
+func (ma *MArrayCRDT[T]) nodeLess(a, b *orderNode[T]) bool {
+	if ma.config.KeepSorted && ma.config.LessFunc != nil {
+		if ma.config.LessFunc(a.value, b.value) {
+			return true
+		}
+		if ma.config.LessFunc(b.value, a.value) {
+			return false
+		}
+	}
+
+	// First compare by position
+	if a.position != b.position {
+		return a.position < b.position
+	}
+	// If positions are equal, use UUID as tiebreaker for deterministic ordering
+	return a.id < b.id
+}
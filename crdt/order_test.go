@@ -0,0 +1,139 @@
+package marraycrdt
+
+import (
+	mathrand "math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// bruteForceIDs sorts the live elements from scratch
+func bruteForceIDs[T any](ma *MArrayCRDT[T]) []string {
+	var live []*Element[T]
+	for _, elem := range ma.items {
+		if !elem.Deleted {
+			live = append(live, elem)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool {
+		a := &orderNode[T]{id: live[i].ID, position: live[i].Index.Position, value: live[i].Value.Data}
+		b := &orderNode[T]{id: live[j].ID, position: live[j].Index.Position, value: live[j].Value.Data}
+		return ma.nodeLess(a, b)
+	})
+
+	ids := make([]string, 0, len(live))
+	for _, elem := range live {
+		ids = append(ids, elem.ID)
+	}
+	return ids
+}
+
+// checkOrder verifies the order tree against a full sort
+func checkOrder[T any](t *testing.T, ma *MArrayCRDT[T]) {
+	t.Helper()
+
+	expected := bruteForceIDs(ma)
+	if got := ma.IDs(); len(got) != len(expected) || (len(got) > 0 && !reflect.DeepEqual(got, expected)) {
+		t.Fatalf("%s: order tree %v differs from full sort %v", ma.replicaID, got, expected)
+	}
+
+	order := ma.orderLocked()
+	for i, id := range expected {
+		if order.rank(id) != i {
+			t.Fatalf("%s: rank of %s is %d, expected %d", ma.replicaID, id, order.rank(id), i)
+		}
+		if order.at(i).ID != id {
+			t.Fatalf("%s: element at %d is %s, expected %s", ma.replicaID, i, order.at(i).ID, id)
+		}
+	}
+	if ma.Len() != len(expected) {
+		t.Fatalf("%s: Len %d, expected %d", ma.replicaID, ma.Len(), len(expected))
+	}
+}
+
+// TestOrderTreeMatchesFullSort tests the order tree against random local and merged edits
+func TestOrderTreeMatchesFullSort(t *testing.T) {
+	r := mathrand.New(mathrand.NewSource(7))
+
+	for _, opts := range [][]Option{nil, {WithAutoSort(func(a, b int) bool { return a < b })}} {
+		replica1 := New[int]("replica1", opts...)
+		replica2 := New[int]("site2", opts...)
+		replicas := []*MArrayCRDT[int]{replica1, replica2}
+
+		for step := 0; step < 400; step++ {
+			ma := replicas[r.Intn(2)]
+			ids := ma.IDs()
+			pick := func() string {
+				if len(ids) == 0 {
+					return ""
+				}
+				return ids[r.Intn(len(ids))]
+			}
+
+			switch r.Intn(10) {
+			case 0, 1:
+				ma.Insert(r.Intn(len(ids)+1), r.Intn(50))
+			case 2:
+				ma.Push(r.Intn(50))
+			case 3:
+				ma.Delete(pick())
+			case 4:
+				ma.Move(pick(), r.Intn(len(ids)+1))
+			case 5:
+				ma.MoveAfter(pick(), pick())
+			case 6:
+				ma.MoveBefore(pick(), pick())
+			case 7:
+				ma.Set(pick(), r.Intn(50))
+			case 8:
+				ma.Swap(pick(), pick())
+			case 9:
+				replicas[0].Merge(replicas[1])
+				replicas[1].Merge(replicas[0])
+			}
+
+			checkOrder(t, ma)
+		}
+
+		replica1.Merge(replica2)
+		replica2.Merge(replica1)
+		checkOrder(t, replica1)
+		checkOrder(t, replica2)
+	}
+}
+
+// TestOrderTreeAfterDecode tests that decoded and cloned replicas rebuild their order
+func TestOrderTreeAfterDecode(t *testing.T) {
+	replica1 := New[string]("replica1")
+	for _, v := range []string{"A", "B", "C", "D"} {
+		_ = replica1.Push(v)
+	}
+	replica1.Reverse()
+
+	data, err := replica1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var decoded MArrayCRDT[string]
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+
+	for _, ma := range []*MArrayCRDT[string]{&decoded, replica1.Clone()} {
+		checkOrder(t, ma)
+		if v, _ := ma.Get(0); v != "D" {
+			t.Errorf("Expected D at index 0, got %v", v)
+		}
+	}
+}
+
+// BenchmarkInsertAtIndex measures positional inserts into a growing array
+func BenchmarkInsertAtIndex(b *testing.B) {
+	ma := New[int]("replica1")
+	r := mathrand.New(mathrand.NewSource(1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ma.Insert(r.Intn(ma.Len()+1), i)
+	}
+}
@@ -0,0 +1,176 @@
+package marraycrdt
+
+import "hash/fnv"
+
+// Position is a dense fractional index. Positions compare as plain strings
+// and there is always room for a new position between any two distinct ones,
+// so elements never need to be renumbered.
+//
+// A position is a base-62 fraction ("0-9A-Za-z", in ASCII order) that never
+// ends in the zero digit. Every freshly allocated position ends with a tag
+// made of a hash of the allocating replica and a per-replica sequence number.
+// The tag is prefix-free, so two replicas that insert into the same gap
+// concurrently still get distinct positions, and a run of positions
+// allocated together shares one unique prefix.
+type Position string
+
+const (
+	positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	positionBase   = len(positionDigits)
+
+	// replicaTagLen is the number of digits used for the replica hash
+	replicaTagLen = 6
+)
+
+// digitValue returns the numeric value of a position digit
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	}
+	return 0
+}
+
+// midpoint returns a key strictly between a and b. An empty a means the
+// start of the key space and an unbounded b means its end. The result never
+// ends in the zero digit and is never a prefix of b, so any suffix can be
+// appended to it without leaving the (a, b) interval.
+func midpoint(a, b string, bounded bool) string {
+	if bounded {
+		n := 0
+		for n < len(b) {
+			da := byte('0')
+			if n < len(a) {
+				da = a[n]
+			}
+			if da != b[n] {
+				break
+			}
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:], true)
+		}
+	}
+
+	digitA := 0
+	if len(a) > 0 {
+		digitA = digitValue(a[0])
+	}
+	digitB := positionBase
+	if bounded {
+		digitB = digitValue(b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(positionDigits[(digitA+digitB+1)/2])
+	}
+
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(positionDigits[digitA]) + midpoint(rest, "", false)
+}
+
+// appendNonZero appends v in base 61 using only non-zero digits, padded to
+// width digits (width 0 means as many as needed)
+func appendNonZero(dst []byte, v uint64, width int) []byte {
+	var digits [16]byte
+	n := 0
+	for v > 0 || n == 0 || n < width {
+		digits[n] = positionDigits[1+v%uint64(positionBase-1)]
+		v /= uint64(positionBase - 1)
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		dst = append(dst, digits[i])
+	}
+	return dst
+}
+
+// parseNonZero is the inverse of appendNonZero
+func parseNonZero(s string) uint64 {
+	var v uint64
+	for i := 0; i < len(s); i++ {
+		v = v*uint64(positionBase-1) + uint64(digitValue(s[i])-1)
+	}
+	return v
+}
+
+// positionTag returns the unique, prefix-free suffix for an allocation
+func positionTag(replicaID string, seq uint64) []byte {
+	h := fnv.New64a()
+	h.Write([]byte(replicaID))
+	sum := h.Sum64()
+
+	tag := make([]byte, 0, replicaTagLen+8)
+	for i := 0; i < replicaTagLen; i++ {
+		tag = append(tag, positionDigits[sum%uint64(positionBase)])
+		sum /= uint64(positionBase)
+	}
+
+	counter := appendNonZero(nil, seq, 0)
+	tag = append(tag, positionDigits[len(counter)])
+	return append(tag, counter...)
+}
+
+// nextPositionSeqLocked returns a fresh allocation number (must hold lock)
+func (ma *MArrayCRDT[T]) nextPositionSeqLocked() uint64 {
+	seq := ma.positionSeq
+	if own := ma.clock.toMap()[ma.replicaID]; own > seq {
+		seq = own
+	}
+	seq++
+	ma.positionSeq = seq
+	return seq
+}
+
+// newPositionLocked allocates a unique position between prev and next. An
+// empty prev means "before everything" and an empty next "after everything".
+func (ma *MArrayCRDT[T]) newPositionLocked(prev, next Position) Position {
+	key := midpoint(string(prev), string(next), boundedBy(prev, next))
+	return Position(key + string(positionTag(ma.replicaID, ma.nextPositionSeqLocked())))
+}
+
+// newPositionRunLocked allocates n ascending positions between prev and next
+// that share one unique prefix, so the run stays contiguous when other
+// replicas insert into the same gap
+func (ma *MArrayCRDT[T]) newPositionRunLocked(prev, next Position, n int) []Position {
+	slot := runSlot(prev, next, positionTag(ma.replicaID, ma.nextPositionSeqLocked()))
+	width := runWidth(n)
+
+	positions := make([]Position, n)
+	for i := range positions {
+		positions[i] = Position(appendNonZero([]byte(slot), uint64(i), width))
+	}
+	return positions
+}
+
+// runSlot returns the unique prefix of a run allocated between prev and next
+func runSlot(prev, next Position, tag []byte) string {
+	return midpoint(string(prev), string(next), boundedBy(prev, next)) + string(tag)
+}
+
+// runWidth returns the suffix width needed to number n positions of a run
+func runWidth(n int) int {
+	width := 1
+	for limit := positionBase - 1; limit < n; limit *= positionBase - 1 {
+		width++
+	}
+	return width
+}
+
+// boundedBy reports whether next is a usable upper bound for prev. Without
+// one the new position goes directly after prev.
+func boundedBy(prev, next Position) bool {
+	return next != "" && prev < next
+}
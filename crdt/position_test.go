@@ -0,0 +1,112 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestRepeatedInsertsAtSameSpot tests that positions never run out of room
+func TestRepeatedInsertsAtSameSpot(t *testing.T) {
+	replica := New[int]("replica1")
+	replica.Push(-1)
+	replica.Push(1000)
+
+	// Always insert directly after the first element; float midpoints
+	// exhausted their precision after about 50 of these
+	for i := 999; i >= 0; i-- {
+		replica.Insert(1, i)
+	}
+
+	got := replica.ToSlice()
+	for i := 0; i <= 1000; i++ {
+		if got[i+1] != i {
+			t.Fatalf("Wrong order at %d: %v", i, got[:i+2])
+		}
+	}
+
+	seen := make(map[Position]bool)
+	for _, elem := range replica.items {
+		if seen[elem.Index.Position] {
+			t.Fatalf("Duplicate position %q", elem.Index.Position)
+		}
+		seen[elem.Index.Position] = true
+	}
+}
+
+// TestConcurrentInsertsSameGap tests that concurrent inserts into one gap stay distinct
+func TestConcurrentInsertsSameGap(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	replica1.Push("A")
+	replica1.Push("D")
+	replica2.Merge(replica1)
+
+	idB := replica1.Insert(1, "B")
+	idC := replica2.Insert(1, "C")
+
+	replica1.Merge(replica2)
+	replica2.Merge(replica1)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Fatalf("Replicas did not converge!\nReplica1: %v\nReplica2: %v",
+			replica1.ToSlice(), replica2.ToSlice())
+	}
+
+	b := replica1.items[idB].Index.Position
+	c := replica1.items[idC].Index.Position
+	if b == c {
+		t.Fatalf("Concurrent inserts got the same position %q", b)
+	}
+
+	// There is still room between the two concurrent inserts
+	replica1.Insert(2, "X")
+	if got := replica1.ToSlice(); got[2] != "X" || len(got) != 5 {
+		t.Errorf("Insert between concurrent elements failed: %v", got)
+	}
+}
+
+// TestMidpointOrdering tests the fractional key arithmetic directly
+func TestMidpointOrdering(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"", "1"},
+		{"V", ""},
+		{"z", ""},
+		{"V", "W"},
+		{"V", "V1"},
+		{"V01", "V1"},
+		{"0001", "1"},
+		{"Vz", "W1"},
+	}
+
+	for _, c := range cases {
+		a, b := c[0], c[1]
+		m := midpoint(a, b, b != "")
+		if m <= a || (b != "" && m >= b) {
+			t.Errorf("midpoint(%q, %q) = %q is out of range", a, b, m)
+		}
+		if m[len(m)-1] == '0' {
+			t.Errorf("midpoint(%q, %q) = %q ends in zero", a, b, m)
+		}
+		if b != "" && len(m) <= len(b) && b[:len(m)] == m {
+			t.Errorf("midpoint(%q, %q) = %q is a prefix of the upper bound", a, b, m)
+		}
+	}
+}
+
+// TestPositionRunOrdering tests runs allocated for bulk reordering
+func TestPositionRunOrdering(t *testing.T) {
+	replica := New[int]("replica1")
+
+	run := replica.newPositionRunLocked("", "", 200)
+	if !sort.SliceIsSorted(run, func(i, j int) bool { return run[i] < run[j] }) {
+		t.Errorf("Run is not ascending")
+	}
+	for i := 1; i < len(run); i++ {
+		if run[i] == run[i-1] {
+			t.Fatalf("Duplicate position in run at %d", i)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package marraycrdt
+
+// Range operations
+//
+// A range operation is a single event: every element it touches is stamped
+// with the same clock and, under WithHybridClock, the same timestamp, and
+// inserted or moved elements get one run of positions with a prefix no other
+// allocation uses (newPositionRunLocked). Positions inserted into the same
+// gap by other replicas sort before or after the whole run, never inside it.
+// When two ranges are moved concurrently, every element both of them moved is
+// resolved by comparing the same pair of clocks and timestamps, so one range
+// wins all of the shared elements and both runs stay contiguous. Ranges
+// travel as ordinary per-element operations and merge like any other change.
+
+// InsertRange inserts values at index as one contiguous run and returns the
+// new element IDs
+func (ma *MArrayCRDT[T]) InsertRange(index int, values []T) []string {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.insertRangeLocked(index, values)
+}
+
+// insertRangeLocked implements InsertRange (must hold lock)
+func (ma *MArrayCRDT[T]) insertRangeLocked(index int, values []T) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	order := ma.orderLocked()
+	index = min(max(index, 0), order.len())
+
+	var prev, next Position
+	if index > 0 {
+		prev = order.at(index - 1).Index.Position
+	}
+	if index < order.len() {
+		next = order.at(index).Index.Position
+	}
+	return ma.insertRunLocked(ma.newPositionRunLocked(prev, next, len(values)), values)
+}
+
+// insertRunLocked inserts values at the given ascending positions as one
+// range operation (must hold lock)
+func (ma *MArrayCRDT[T]) insertRunLocked(positions []Position, values []T) []string {
+	stamp := ma.rangeStampLocked()
+	now := ma.nowLocked()
+
+	ids := make([]string, len(values))
+	for i, value := range values {
+		elem := &Element[T]{
+			ID: generateUUID(),
+			Value: &VersionedValue[T]{
+				Data:        value,
+				VectorClock: stamp.Fork(),
+				Timestamp:   now,
+				Writer:      ma.replicaID,
+			},
+			Index: &VersionedIndex{
+				Position:    positions[i],
+				VectorClock: stamp.Fork(),
+				Timestamp:   ma.hybridTime(now),
+			},
+			VectorClock: stamp.Fork(),
+		}
+
+		ma.addElementLocked(elem)
+		ma.touchLocked(OpInsert, elem)
+		ma.emitLocked(OpInsert, elem)
+		ids[i] = elem.ID
+	}
+
+	return ids
+}
+
+// DeleteRange deletes the live elements in [from, to) and returns how many
+// were deleted
+func (ma *MArrayCRDT[T]) DeleteRange(from, to int) int {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.deleteRangeLocked(from, to)
+}
+
+// deleteRangeLocked implements DeleteRange (must hold lock)
+func (ma *MArrayCRDT[T]) deleteRangeLocked(from, to int) int {
+	elements := ma.rangeLocked(from, to)
+	if len(elements) == 0 {
+		return 0
+	}
+
+	stamp := ma.rangeStampLocked()
+	now := ma.hybridNowLocked()
+	for _, elem := range elements {
+		ma.touchLocked(OpDelete, elem)
+		elem.Deleted = true
+		elem.DeleteClock = stamp.Fork()
+		elem.DeleteTime = now
+		elem.VectorClock.Merge(stamp)
+		ma.emitLocked(OpDelete, elem)
+		ma.reorderLocked(elem.ID)
+	}
+
+	return len(elements)
+}
+
+// MoveRange moves the run of live elements from fromID through toID
+// (inclusive, in either order) directly after afterID, or to the front when
+// afterID is empty. It fails if an ID is unknown or afterID lies in the run.
+func (ma *MArrayCRDT[T]) MoveRange(fromID, toID, afterID string) bool {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	return ma.moveRangeLocked(fromID, toID, afterID)
+}
+
+// moveRangeLocked implements MoveRange (must hold lock)
+func (ma *MArrayCRDT[T]) moveRangeLocked(fromID, toID, afterID string) bool {
+	order := ma.orderLocked()
+
+	first, last := order.rank(fromID), order.rank(toID)
+	if first < 0 || last < 0 {
+		return false
+	}
+	if first > last {
+		first, last = last, first
+	}
+
+	// Neighbours of the gap after afterID, skipping over the run itself
+	var prev Position
+	at := 0
+	if afterID != "" {
+		after := order.rank(afterID)
+		if after < 0 || (after >= first && after <= last) {
+			return false
+		}
+		prev = order.at(after).Index.Position
+		at = after + 1
+	}
+	if at == first {
+		at = last + 1
+	}
+	var next Position
+	if elem := order.at(at); elem != nil {
+		next = elem.Index.Position
+	}
+
+	elements := ma.rangeLocked(first, last+1)
+	positions := ma.newPositionRunLocked(prev, next, len(elements))
+	stamp := ma.rangeStampLocked()
+	now := ma.hybridNowLocked()
+
+	for i, elem := range elements {
+		ma.touchLocked(OpMove, elem)
+		elem.Index.Position = positions[i]
+		elem.Index.VectorClock = stamp.Fork()
+		elem.Index.Timestamp = now
+		elem.VectorClock.Merge(stamp)
+		ma.emitLocked(OpMove, elem)
+	}
+	for _, elem := range elements {
+		ma.reorderLocked(elem.ID)
+	}
+
+	return true
+}
+
+// rangeLocked returns the live elements in [from, to), clamped to the array
+// (must hold lock)
+func (ma *MArrayCRDT[T]) rangeLocked(from, to int) []*Element[T] {
+	order := ma.orderLocked()
+	from = max(from, 0)
+	to = min(to, order.len())
+	if from >= to {
+		return nil
+	}
+
+	elements := make([]*Element[T], 0, to-from)
+	walkNodes(order.root, from, func(node *orderNode[T]) bool {
+		elements = append(elements, node.elem)
+		return len(elements) < to-from
+	})
+	return elements
+}
+
+// rangeStampLocked advances the replica clock by one event shared by every
+// element of a range operation (must hold lock)
+func (ma *MArrayCRDT[T]) rangeStampLocked() *VectorClock {
+	ma.clock.Increment(ma.replicaID)
+	return ma.clock.Fork()
+}
@@ -0,0 +1,141 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestInsertRangeStaysContiguous tests that concurrent pastes into the same gap do not interleave
+func TestInsertRangeStaysContiguous(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	_ = replica1.Push("[")
+	_ = replica1.Push("]")
+	replica2.Merge(replica1)
+
+	ids := replica1.InsertRange(1, []string{"a1", "a2", "a3"})
+	if len(ids) != 3 {
+		t.Fatalf("Expected 3 IDs, got %d", len(ids))
+	}
+	_ = replica2.InsertRange(1, []string{"b1", "b2", "b3"})
+	replica2.Insert(2, "b*")
+
+	syncAll(replica1, replica2)
+
+	got := strings.Join(replica1.ToSlice(), " ")
+	if got != "[ a1 a2 a3 b1 b* b2 b3 ]" && got != "[ b1 b* b2 b3 a1 a2 a3 ]" {
+		t.Errorf("Runs interleaved: %s", got)
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestDeleteRange tests deleting a slice of the array and its replication
+func TestDeleteRange(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	ops := collectOps(replica1)
+
+	replica1.InsertRange(0, []string{"A", "B", "C", "D", "E"})
+	if n := replica1.DeleteRange(1, 4); n != 3 {
+		t.Errorf("Expected 3 deletions, got %d", n)
+	}
+	if n := replica1.DeleteRange(5, 9); n != 0 {
+		t.Errorf("Out of range delete removed %d elements", n)
+	}
+
+	if err := replica2.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	for _, r := range []*MArrayCRDT[string]{replica1, replica2} {
+		if !reflect.DeepEqual(r.ToSlice(), []string{"A", "E"}) {
+			t.Errorf("%s: expected [A E], got %v", r.replicaID, r.ToSlice())
+		}
+	}
+}
+
+// TestMoveRange tests moving a block to the front, the middle and after itself
+func TestMoveRange(t *testing.T) {
+	replica1 := New[string]("replica1")
+	ids := replica1.InsertRange(0, []string{"A", "B", "C", "D", "E"})
+
+	if !replica1.MoveRange(ids[3], ids[1], ids[4]) {
+		t.Fatalf("MoveRange failed")
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"A", "E", "B", "C", "D"}) {
+		t.Errorf("Expected [A E B C D], got %v", replica1.ToSlice())
+	}
+
+	if !replica1.MoveRange(ids[1], ids[3], "") {
+		t.Fatalf("MoveRange to front failed")
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"B", "C", "D", "A", "E"}) {
+		t.Errorf("Expected [B C D A E], got %v", replica1.ToSlice())
+	}
+
+	if replica1.MoveRange(ids[1], ids[3], ids[2]) {
+		t.Errorf("Moving a range after one of its own elements should fail")
+	}
+}
+
+// TestConcurrentMoveRangeStaysContiguous tests that overlapping concurrent block moves do not interleave
+func TestConcurrentMoveRangeStaysContiguous(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	ids := replica1.InsertRange(0, []string{"A", "B", "C", "D", "E", "F", "G"})
+	replica2.Merge(replica1)
+
+	// replica1 drags B..D to the end, site2 drags C..E to the front
+	replica1.MoveRange(ids[1], ids[3], ids[6])
+	replica2.MoveRange(ids[2], ids[4], "")
+
+	syncAll(replica1, replica2)
+
+	// One move wins both shared elements C and D
+	got := strings.Join(replica1.ToSlice(), "")
+	if got != "EAFGBCD" && got != "CDEAFGB" {
+		t.Errorf("Moved ranges were split: %s", got)
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// tickingClock returns a clock source that starts at start and advances by
+// step on every reading
+func tickingClock(start time.Time, step time.Duration) func() time.Time {
+	now := start
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+// TestConcurrentMoveRangeHybridClock tests that a range shares one timestamp, so clocks ticking at different rates cannot split it
+func TestConcurrentMoveRangeHybridClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	replica1 := New[string]("replica1", WithHybridClock(tickingClock(start, 10*time.Nanosecond)))
+	replica2 := New[string]("site2", WithHybridClock(tickingClock(start.Add(25*time.Nanosecond), time.Nanosecond)))
+
+	ids := replica1.InsertRange(0, []string{"p", "q", "r", "s", "x", "y"})
+	replica2.Merge(replica1)
+
+	// replica1 ticks ten times faster, so per-element readings would interleave
+	replica1.MoveRange(ids[0], ids[3], ids[4])
+	replica2.MoveRange(ids[0], ids[3], ids[5])
+
+	syncAll(replica1, replica2)
+
+	got := strings.Join(replica1.ToSlice(), "")
+	if got != "xpqrsy" && got != "xypqrs" {
+		t.Errorf("Moved range was split: %s", got)
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
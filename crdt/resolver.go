@@ -0,0 +1,183 @@
+package marraycrdt
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+)
+
+// Value resolution
+//
+// Concurrent Sets of one element are settled by a ValueResolver chosen per
+// array with WithValueResolver. The resolver always receives the two
+// versions in the same order, whichever replica merges first, so it only has
+// to be deterministic. It either returns one of them unchanged (a selection,
+// keeping that version's clock and timestamp) or a new value built with
+// Combine, which carries the clocks of both. Resolvers must be commutative,
+// associative and idempotent for three or more replicas to converge; the
+// built-in ones are.
+//
+// Mergeable values ignore the resolver and merge recursively, see nested.go.
+
+// ValueVersion is one concurrently written value of an element
+type ValueVersion[T any] struct {
+	Value  T
+	Clock  *VectorClock
+	Time   Timestamp
+	Writer string // empty for combined values
+}
+
+// ValueResolver decides the value of an element after concurrent Sets. a is
+// ordered before b by ReplicaWins, so b is the version the default keeps.
+type ValueResolver[T any] interface {
+	Resolve(a, b ValueVersion[T]) ValueVersion[T]
+}
+
+// resolverFunc adapts a function to ValueResolver
+type resolverFunc[T any] func(a, b ValueVersion[T]) ValueVersion[T]
+
+// Resolve implements ValueResolver
+func (f resolverFunc[T]) Resolve(a, b ValueVersion[T]) ValueVersion[T] {
+	return f(a, b)
+}
+
+// WithValueResolver sets how concurrent Sets of the same element are resolved
+func WithValueResolver[T any](resolver ValueResolver[T]) Option {
+	return func(c *Config) {
+		c.ValueResolver = resolver
+	}
+}
+
+// Combine returns a version holding value that supersedes both v and other
+func (v ValueVersion[T]) Combine(other ValueVersion[T], value T) ValueVersion[T] {
+	clock := v.Clock.Clone()
+	clock.Merge(other.Clock)
+	return ValueVersion[T]{Value: value, Clock: clock, Time: laterTimestamp(v.Time, other.Time)}
+}
+
+// ReplicaWins keeps the version whose clock names the highest replica ID,
+// comparing the clocks entry by entry when that is the same. This is the
+// default unless WithHybridClock is set, which makes LastWriterWins the
+// default.
+func ReplicaWins[T any]() ValueResolver[T] {
+	return resolverFunc[T](func(a, b ValueVersion[T]) ValueVersion[T] {
+		return b
+	})
+}
+
+// LastWriterWins keeps the version with the later hybrid timestamp and falls
+// back to ReplicaWins when the timestamps are equal
+func LastWriterWins[T any]() ValueResolver[T] {
+	return resolverFunc[T](func(a, b ValueVersion[T]) ValueVersion[T] {
+		if a.Time.Compare(b.Time) > 0 {
+			return a
+		}
+		return b
+	})
+}
+
+// KeepAll keeps every value written by either side as a sorted set, so no
+// concurrent write is lost. A later Set replaces the whole set.
+func KeepAll[E cmp.Ordered]() ValueResolver[[]E] {
+	return resolverFunc[[]E](func(a, b ValueVersion[[]E]) ValueVersion[[]E] {
+		values := slices.Concat(a.Value, b.Value)
+		slices.Sort(values)
+		return a.Combine(b, slices.Compact(values))
+	})
+}
+
+// MergeValues combines concurrent values with merge, which must be
+// commutative, associative and idempotent
+func MergeValues[T any](merge func(a, b T) T) ValueResolver[T] {
+	return resolverFunc[T](func(a, b ValueVersion[T]) ValueVersion[T] {
+		return a.Combine(b, merge(a.Value, b.Value))
+	})
+}
+
+// MaxValue keeps the larger of two concurrent values
+func MaxValue[T cmp.Ordered]() ValueResolver[T] {
+	return resolverFunc[T](func(a, b ValueVersion[T]) ValueVersion[T] {
+		if cmp.Compare(a.Value, b.Value) > 0 {
+			return a
+		}
+		return b
+	})
+}
+
+// MinValue keeps the smaller of two concurrent values
+func MinValue[T cmp.Ordered]() ValueResolver[T] {
+	return resolverFunc[T](func(a, b ValueVersion[T]) ValueVersion[T] {
+		if cmp.Compare(a.Value, b.Value) < 0 {
+			return a
+		}
+		return b
+	})
+}
+
+// version returns the value as a ValueVersion sharing its clock
+func (v *VersionedValue[T]) version() ValueVersion[T] {
+	return ValueVersion[T]{Value: v.Data, Clock: v.VectorClock, Time: v.Timestamp, Writer: v.Writer}
+}
+
+// valueResolver returns the configured resolver, or the default for the
+// clock in use
+func (ma *MArrayCRDT[T]) valueResolver() ValueResolver[T] {
+	if resolver, ok := ma.config.ValueResolver.(ValueResolver[T]); ok {
+		return resolver
+	}
+	if ma.config.HybridClock {
+		return LastWriterWins[T]()
+	}
+	return ReplicaWins[T]()
+}
+
+// resolveValueLocked settles two concurrent values of an element (must hold lock)
+func (ma *MArrayCRDT[T]) resolveValueLocked(local, remote *VersionedValue[T]) *VersionedValue[T] {
+	if sameClock(local.VectorClock, remote.VectorClock) {
+		return local
+	}
+
+	a, b := local.version(), remote.version()
+	if compareReplicaOrder(a.Clock, b.Clock) > 0 {
+		a, b = b, a
+	}
+
+	resolved := ma.valueResolver().Resolve(a, b)
+	if resolved.Clock == nil {
+		resolved.Clock = a.Combine(b, resolved.Value).Clock
+	}
+	return &VersionedValue[T]{
+		Data:        resolved.Value,
+		VectorClock: resolved.Clock.Fork(),
+		Timestamp:   resolved.Time,
+		Writer:      resolved.Writer,
+	}
+}
+
+// compareReplicaOrder orders concurrent clocks by their highest replica ID,
+// then by their counters in replica order. Distinct clocks never compare
+// equal, so every replica picks the same winner.
+func compareReplicaOrder(a, b *VectorClock) int {
+	if c := cmp.Compare(a.GetMaxReplica(), b.GetMaxReplica()); c != 0 {
+		return c
+	}
+
+	ac, bc := a.toMap(), b.toMap()
+	replicas := make([]string, 0, len(ac)+len(bc))
+	for replica := range ac {
+		replicas = append(replicas, replica)
+	}
+	for replica := range bc {
+		if _, ok := ac[replica]; !ok {
+			replicas = append(replicas, replica)
+		}
+	}
+	sort.Strings(replicas)
+
+	for _, replica := range replicas {
+		if c := cmp.Compare(ac[replica], bc[replica]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package marraycrdt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// concurrentSets has three replicas set one element concurrently, merges
+// them in several orders and groupings, and returns the value they agree on
+func concurrentSets[T any](t *testing.T, values [3]T, opts ...Option) T {
+	t.Helper()
+	now := time.Unix(1700000000, 0)
+	opts = append([]Option{WithHybridClock(func() time.Time { return now })}, opts...)
+	replicas := []*MArrayCRDT[T]{
+		New[T]("replica1", opts...),
+		New[T]("site2", opts...),
+		New[T]("site3", opts...),
+	}
+
+	var zero T
+	id := replicas[0].Push(zero)
+	syncAll(replicas...)
+	// replica1 writes last, which ReplicaWins ignores
+	for i := len(replicas) - 1; i >= 0; i-- {
+		now = now.Add(time.Second)
+		replicas[i].Set(id, values[i])
+	}
+
+	var results []T
+	for _, order := range [][3]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}} {
+		target := replicas[order[0]].Clone()
+		target.Merge(replicas[order[1]])
+		target.Merge(replicas[order[2]])
+		value, _ := target.Get(0)
+		results = append(results, value)
+	}
+	grouped := replicas[1].Clone()
+	grouped.Merge(replicas[2])
+	target := replicas[0].Clone()
+	target.Merge(grouped)
+	value, _ := target.Get(0)
+	results = append(results, value)
+
+	for _, result := range results[1:] {
+		if !reflect.DeepEqual(result, results[0]) {
+			t.Fatalf("Replicas did not converge! %v", results)
+		}
+	}
+	return results[0]
+}
+
+// TestConcurrentSetsConvergeByDefault tests concurrent Sets whose clocks name the same replicas
+func TestConcurrentSetsConvergeByDefault(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	id := replica1.Push("a")
+	replica2.Merge(replica1)
+	replica2.Push("b")
+	replica1.Merge(replica2)
+
+	// Both value clocks now have site2 as their highest replica
+	replica1.Set(id, "x")
+	replica2.Set(id, "y")
+
+	before := replica1.Clone()
+	replica1.Merge(replica2)
+	replica2.Merge(before)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestValueResolverPolicies tests that every built-in resolver converges to its expected value
+func TestValueResolverPolicies(t *testing.T) {
+	if got := concurrentSets(t, [3]string{"x", "y", "z"}, WithValueResolver(ReplicaWins[string]())); got != "z" {
+		t.Errorf("ReplicaWins: expected z, got %v", got)
+	}
+	if got := concurrentSets(t, [3]string{"x", "y", "z"}); got != "x" {
+		t.Errorf("Hybrid clock default: expected x, got %v", got)
+	}
+	if got := concurrentSets(t, [3]string{"x", "y", "z"}, WithValueResolver(LastWriterWins[string]())); got != "x" {
+		t.Errorf("LastWriterWins: expected x, got %v", got)
+	}
+	if got := concurrentSets(t, [3][]string{{"x"}, {"y", "x"}, {"z"}}, WithValueResolver(KeepAll[string]())); !reflect.DeepEqual(got, []string{"x", "y", "z"}) {
+		t.Errorf("KeepAll: expected [x y z], got %v", got)
+	}
+	union := MergeValues(func(a, b int) int { return a | b })
+	if got := concurrentSets(t, [3]int{1, 2, 4}, WithValueResolver(union)); got != 7 {
+		t.Errorf("MergeValues: expected 7, got %v", got)
+	}
+	if got := concurrentSets(t, [3]int{3, 9, 5}, WithValueResolver(MaxValue[int]())); got != 9 {
+		t.Errorf("MaxValue: expected 9, got %v", got)
+	}
+	if got := concurrentSets(t, [3]int{3, 9, 5}, WithValueResolver(MinValue[int]())); got != 3 {
+		t.Errorf("MinValue: expected 3, got %v", got)
+	}
+}
+
+// TestKeepAllResolvedBySet tests that a Set after the merge replaces the kept values
+func TestKeepAllResolvedBySet(t *testing.T) {
+	opt := WithValueResolver(KeepAll[string]())
+	replica1 := New[[]string]("replica1", opt)
+	replica2 := New[[]string]("site2", opt)
+
+	id := replica1.Push(nil)
+	replica2.Merge(replica1)
+	replica1.Set(id, []string{"draft"})
+	replica2.Set(id, []string{"final"})
+	syncAll(replica1, replica2)
+
+	if value, _ := replica1.Get(0); !reflect.DeepEqual(value, []string{"draft", "final"}) {
+		t.Fatalf("Expected both values, got %v", value)
+	}
+	replica2.Set(id, []string{"final"})
+	replica1.Merge(replica2)
+	if value, _ := replica1.Get(0); !reflect.DeepEqual(value, []string{"final"}) {
+		t.Errorf("A later Set should win outright, got %v", value)
+	}
+}
+
+// TestTimestampsSurviveEncoding tests that LastWriterWins sees the same timestamps after a round trip
+func TestTimestampsSurviveEncoding(t *testing.T) {
+	opt := WithValueResolver(LastWriterWins[string]())
+	replica1 := New[string]("replica1", opt, WithHybridClock(func() time.Time { return time.Unix(200, 0) }))
+	replica2 := New[string]("site2", opt, WithHybridClock(func() time.Time { return time.Unix(100, 0) }))
+
+	id := replica2.Push("a")
+	replica1.Merge(replica2)
+	replica1.Set(id, "late")
+	replica2.Set(id, "early")
+
+	data, err := replica1.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	fromBinary := New[string]("other", opt)
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+
+	data, err = json.Marshal(replica1)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	fromJSON := New[string]("other", opt)
+	if err := json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+
+	for _, decoded := range []*MArrayCRDT[string]{fromBinary, fromJSON} {
+		replica := replica2.Clone()
+		replica.Merge(decoded)
+		if value, _ := replica.Get(0); value != "late" {
+			t.Errorf("Expected the later write to win, got %v", value)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package marraycrdt
+
+// Snapshots
+//
+// A Snapshot is an immutable view of the live elements at the moment it was
+// taken. Taking one only copies the root of the persistent order tree (see
+// order.go) under the read lock, so it is O(1); reading it needs no lock at
+// all and never blocks or is blocked by writers, Merge or other readers.
+// Values are copied into the tree when they change, but a value that holds
+// pointers, slices or maps still shares what they point to.
+
+// ElementView is a read-only copy of one live element
+type ElementView[T any] struct {
+	ID       string
+	Value    T
+	Position Position
+}
+
+// Snapshot is a consistent, read-only view of the array
+type Snapshot[T any] struct {
+	root  *orderNode[T]
+	clock *VectorClock
+}
+
+// Snapshot returns a view of the current state that later changes do not affect
+func (ma *MArrayCRDT[T]) Snapshot() *Snapshot[T] {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return &Snapshot[T]{
+		root:  ma.orderLocked().root,
+		clock: ma.clock.Clone(),
+	}
+}
+
+// rootView returns the current order root without copying the clock
+func (ma *MArrayCRDT[T]) rootView() *Snapshot[T] {
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return &Snapshot[T]{root: ma.orderLocked().root}
+}
+
+// Version returns the replica clock the snapshot was taken at
+func (s *Snapshot[T]) Version() *VectorClock {
+	return s.clock.Clone()
+}
+
+// Len returns the number of live elements
+func (s *Snapshot[T]) Len() int {
+	return s.root.count()
+}
+
+// Get returns the value at index
+func (s *Snapshot[T]) Get(index int) (T, bool) {
+	node := nodeAt(s.root, index)
+	if node == nil {
+		var zero T
+		return zero, false
+	}
+	return node.value, true
+}
+
+// Element returns the element at index
+func (s *Snapshot[T]) Element(index int) (ElementView[T], bool) {
+	node := nodeAt(s.root, index)
+	if node == nil {
+		return ElementView[T]{}, false
+	}
+	return node.view(), true
+}
+
+// ToSlice returns the values in order
+func (s *Snapshot[T]) ToSlice() []T {
+	result := make([]T, 0, s.Len())
+	walkNodes(s.root, 0, func(node *orderNode[T]) bool {
+		result = append(result, node.value)
+		return true
+	})
+	return result
+}
+
+// IDs returns the element IDs in order
+func (s *Snapshot[T]) IDs() []string {
+	result := make([]string, 0, s.Len())
+	walkNodes(s.root, 0, func(node *orderNode[T]) bool {
+		result = append(result, node.id)
+		return true
+	})
+	return result
+}
+
+func (n *orderNode[T]) view() ElementView[T] {
+	return ElementView[T]{ID: n.id, Value: n.value, Position: n.position}
+}
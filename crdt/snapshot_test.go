@@ -0,0 +1,100 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestSnapshotIsolation tests that a snapshot does not see later writes or merges
+func TestSnapshotIsolation(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+	_ = replica1.Push("C")
+
+	snap := replica1.Snapshot()
+	version := snap.Version()
+
+	replica1.Set(idA, "A2")
+	replica1.Delete(idB)
+	replica1.Reverse()
+	_ = replica2.Push("X")
+	replica1.Merge(replica2)
+
+	if !reflect.DeepEqual(snap.ToSlice(), []string{"A", "B", "C"}) {
+		t.Errorf("Snapshot changed: %v", snap.ToSlice())
+	}
+	if snap.Len() != 3 {
+		t.Errorf("Expected snapshot length 3, got %d", snap.Len())
+	}
+	if v, ok := snap.Get(1); !ok || v != "B" {
+		t.Errorf("Expected B at index 1, got %v", v)
+	}
+	if e, ok := snap.Element(0); !ok || e.ID != idA || e.Value != "A" {
+		t.Errorf("Unexpected element view %+v", e)
+	}
+	if !reflect.DeepEqual(snap.Version().toMap(), version.toMap()) || !replica1.Clock().Dominates(version) {
+		t.Errorf("Snapshot version should stay at %v", version.toMap())
+	}
+
+	current := replica1.Snapshot()
+	if !reflect.DeepEqual(current.ToSlice(), replica1.ToSlice()) {
+		t.Errorf("Fresh snapshot %v differs from ToSlice %v", current.ToSlice(), replica1.ToSlice())
+	}
+	if !reflect.DeepEqual(current.IDs(), replica1.IDs()) {
+		t.Errorf("Fresh snapshot IDs differ from IDs")
+	}
+}
+
+// TestSnapshotConcurrentReaders tests readers iterating snapshots while writers run (use -race)
+func TestSnapshotConcurrentReaders(t *testing.T) {
+	replica1 := New[int]("replica1")
+	replica2 := New[int]("site2")
+	for i := 0; i < 50; i++ {
+		_ = replica1.Push(i)
+		_ = replica2.Push(100 + i)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := replica1.Snapshot()
+				if len(snap.ToSlice()) != snap.Len() || len(snap.IDs()) != snap.Len() {
+					t.Errorf("Inconsistent snapshot")
+					return
+				}
+				_ = replica1.ToSlice()
+				_ = replica1.String()
+				_ = replica1.Len()
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		switch i % 4 {
+		case 0:
+			replica1.Insert(i%10, i)
+		case 1:
+			replica1.Reverse()
+		case 2:
+			replica1.Merge(replica2)
+		case 3:
+			_, _ = replica1.Pop()
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
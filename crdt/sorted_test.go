@@ -0,0 +1,88 @@
+package marraycrdt
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestAutoSortIsLocalView tests that KeepSorted orders by value without rewriting positions
+func TestAutoSortIsLocalView(t *testing.T) {
+	replica := New[int]("replica1", WithAutoSort(func(a, b int) bool { return a < b }))
+
+	id5 := replica.Push(5)
+	replica.Push(1)
+	replica.Push(3)
+
+	if !reflect.DeepEqual(replica.ToSlice(), []int{1, 3, 5}) {
+		t.Fatalf("Expected [1 3 5], got %v", replica.ToSlice())
+	}
+
+	before := replica.items[id5].Index.VectorClock.toMap()
+	replica.Push(4)
+	replica.Insert(0, 2)
+	if after := replica.items[id5].Index.VectorClock.toMap(); !reflect.DeepEqual(before, after) {
+		t.Errorf("Inserting into a sorted array rewrote an index clock: %v -> %v", before, after)
+	}
+
+	replica.Set(id5, 0)
+	if !reflect.DeepEqual(replica.ToSlice(), []int{0, 1, 2, 3, 4}) {
+		t.Errorf("Expected [0 1 2 3 4] after Set, got %v", replica.ToSlice())
+	}
+}
+
+// TestAutoSortDoesNotClobberConcurrentMove tests that a sorted replica never overrides a remote move
+func TestAutoSortDoesNotClobberConcurrentMove(t *testing.T) {
+	sorted := New[string]("zeta", WithAutoSort(func(a, b string) bool { return a < b }))
+	plain := New[string]("alpha")
+
+	idA := plain.Push("A")
+	plain.Push("B")
+	plain.Push("C")
+	sorted.Merge(plain)
+
+	// Concurrently: the plain replica moves A to the end while the sorted
+	// replica keeps adding elements
+	plain.Move(idA, 2)
+	movedTo := plain.items[idA].Index.Position
+	sorted.Push("D")
+	sorted.Unshift("0")
+
+	plain.Merge(sorted)
+	sorted.Merge(plain)
+
+	if got := sorted.items[idA].Index.Position; got != movedTo {
+		t.Errorf("Concurrent move was overridden: position %q, expected %q", got, movedTo)
+	}
+	if got := plain.ToSlice(); got[0] != "0" || got[1] != "B" || got[2] != "C" {
+		t.Errorf("Expected A to stay moved behind B and C on the plain replica, got %v", got)
+	}
+	if got := sorted.ToSlice(); !reflect.DeepEqual(got, []string{"0", "A", "B", "C", "D"}) {
+		t.Errorf("Expected [0 A B C D] on the sorted replica, got %v", got)
+	}
+}
+
+// TestAutoSortReplicasConverge tests that sorted views agree after concurrent edits
+func TestAutoSortReplicasConverge(t *testing.T) {
+	less := WithAutoSort(func(a, b int) bool { return a < b })
+	replica1 := New[int]("replica1", less)
+	replica2 := New[int]("site2", less)
+
+	id := replica1.Push(10)
+	replica1.Push(20)
+	replica2.Merge(replica1)
+
+	replica1.Set(id, 30)
+	replica2.Push(15)
+	replica2.Push(10)
+
+	replica1.Merge(replica2)
+	replica2.Merge(replica1)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge!\nReplica1: %v\nReplica2: %v",
+			replica1.ToSlice(), replica2.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), []int{10, 15, 20, 30}) {
+		t.Errorf("Expected [10 15 20 30], got %v", replica1.ToSlice())
+	}
+}
@@ -0,0 +1,173 @@
+package marraycrdt
+
+// Collaborative text
+//
+// Text is an MArrayCRDT of runes with a string-oriented API, so every
+// character is an ordinary element: operations, deltas, both encodings,
+// marks, cursors, observers, undo and Compact work on text unchanged, and an
+// edit costs O(log n) per character through the order tree.
+//
+// What text adds is run compression. InsertText is one range operation (see
+// range.go): its characters share one clock event, forked from a single
+// causal context, and one run of positions, a unique slot followed by a
+// fixed-width offset. Typing directly after the last character of the run
+// this replica inserted last extends that run instead of allocating a new
+// one, so text typed one key at a time keeps short positions with a common
+// prefix rather than nesting a little deeper with every key. A run is
+// extended only while its next offsets still sort before the character that
+// follows, so characters that other replicas inserted after it are never
+// skipped.
+//
+// Selections are pairs of Cursors that stick to the selected characters, so
+// text typed at either edge stays outside the selection.
+
+// textRunWidth is the minimum offset width of a typed run; two digits let it
+// grow to 3721 characters
+const textRunWidth = 2
+
+// Text is a collaborative plain-text CRDT
+type Text struct {
+	*MArrayCRDT[rune]
+
+	// Run this replica inserted into last, guarded by the array lock: its
+	// slot, offset width, next unused offset and the position of its last
+	// character
+	openSlot  string
+	openWidth int
+	openNext  int
+	openLast  Position
+}
+
+// Selection is a range of text held by two cursors. Text inserted at either
+// edge stays outside the selection.
+type Selection struct {
+	Start Cursor `json:"start"`
+	End   Cursor `json:"end"`
+}
+
+// NewText creates an empty text for the given replica
+func NewText(replicaID string, opts ...Option) *Text {
+	return &Text{MArrayCRDT: New[rune](replicaID, opts...)}
+}
+
+// InsertText inserts s before the character at pos and returns the IDs of
+// the new characters
+func (t *Text) InsertText(pos int, s string) []string {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return nil
+	}
+
+	ma := t.MArrayCRDT
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	order := ma.orderLocked()
+	pos = min(max(pos, 0), order.len())
+
+	var prev, next Position
+	if pos > 0 {
+		prev = order.at(pos - 1).Index.Position
+	}
+	if pos < order.len() {
+		next = order.at(pos).Index.Position
+	}
+	return ma.insertRunLocked(t.runPositionsLocked(prev, next, len(runes)), runes)
+}
+
+// runPositionsLocked returns n positions between prev and next, extending
+// the open run when prev is its last character (must hold lock)
+func (t *Text) runPositionsLocked(prev, next Position, n int) []Position {
+	ma := t.MArrayCRDT
+	if t.openSlot == "" || prev != t.openLast || t.openNext+n > runCapacity(t.openWidth) ||
+		(next != "" && t.runPosition(t.openNext+n-1) >= next) {
+		t.openSlot = runSlot(prev, next, positionTag(ma.replicaID, ma.nextPositionSeqLocked()))
+		t.openWidth = max(textRunWidth, runWidth(n))
+		t.openNext = 0
+	}
+
+	positions := make([]Position, n)
+	for i := range positions {
+		positions[i] = t.runPosition(t.openNext + i)
+	}
+	t.openNext += n
+	t.openLast = positions[n-1]
+	return positions
+}
+
+// runPosition returns the position at an offset of the open run
+func (t *Text) runPosition(offset int) Position {
+	return Position(appendNonZero([]byte(t.openSlot), uint64(offset), t.openWidth))
+}
+
+// runCapacity returns how many offsets a run of the given width holds
+func runCapacity(width int) int {
+	capacity := 1
+	for range width {
+		capacity *= positionBase - 1
+	}
+	return capacity
+}
+
+// DeleteText deletes up to n characters starting at pos and returns how many
+// were deleted
+func (t *Text) DeleteText(pos, n int) int {
+	return t.DeleteRange(pos, pos+n)
+}
+
+// String returns the live characters as a string
+func (t *Text) String() string {
+	return string(t.ToSlice())
+}
+
+// Merge merges another text into this one
+func (t *Text) Merge(other *Text) {
+	t.MArrayCRDT.Merge(other.MArrayCRDT)
+}
+
+// DeltaSince returns a partial text holding the characters and marks that
+// changed after vc, see MArrayCRDT.DeltaSince
+func (t *Text) DeltaSince(vc *VectorClock) *Text {
+	return &Text{MArrayCRDT: t.MArrayCRDT.DeltaSince(vc)}
+}
+
+// MergeDelta folds a delta produced by DeltaSince into this text
+func (t *Text) MergeDelta(delta *Text) {
+	t.MArrayCRDT.MergeDelta(delta.MArrayCRDT)
+}
+
+// Select returns a selection of the characters in [from, to)
+func (t *Text) Select(from, to int) Selection {
+	if from > to {
+		from, to = to, from
+	}
+
+	ma := t.MArrayCRDT
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	return Selection{
+		Start: ma.cursorAtLocked(from, SideBefore),
+		End:   ma.cursorAtLocked(to, SideAfter),
+	}
+}
+
+// ResolveSelection returns the current bounds of a selection
+func (t *Text) ResolveSelection(sel Selection) (from, to int, ok bool) {
+	ma := t.MArrayCRDT
+	ma.mu.RLock()
+	defer ma.mu.RUnlock()
+
+	from, ok = ma.resolveCursorLocked(sel.Start)
+	if !ok {
+		return 0, 0, false
+	}
+	to, ok = ma.resolveCursorLocked(sel.End)
+	if !ok {
+		return 0, 0, false
+	}
+	// Text inserted into a collapsed selection lands between its cursors
+	return from, max(from, to), true
+}
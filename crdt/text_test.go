@@ -0,0 +1,247 @@
+package marraycrdt
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syncTexts merges every text into every other one
+func syncTexts(texts ...*Text) {
+	for _, a := range texts {
+		for _, b := range texts {
+			if a != b {
+				a.Merge(b)
+			}
+		}
+	}
+}
+
+// textPositions returns the positions of the live characters in order
+func textPositions(text *Text) []Position {
+	var positions []Position
+	for _, id := range text.IDs() {
+		positions = append(positions, text.items[id].Index.Position)
+	}
+	return positions
+}
+
+// TestTextInsertDelete tests local editing
+func TestTextInsertDelete(t *testing.T) {
+	text := NewText("replica1")
+	text.InsertText(0, "hello")
+	text.InsertText(5, " world")
+	text.InsertText(0, ">> ")
+	text.InsertText(100, "!")
+
+	if text.String() != ">> hello world!" {
+		t.Errorf("Expected \">> hello world!\", got %q", text.String())
+	}
+
+	if n := text.DeleteText(3, 6); n != 6 {
+		t.Errorf("Expected 6 deletions, got %d", n)
+	}
+	if n := text.DeleteText(-2, 4); n != 2 {
+		t.Errorf("Expected 2 deletions, got %d", n)
+	}
+	if n := text.DeleteText(20, 5); n != 0 {
+		t.Errorf("Out of range delete removed %d characters", n)
+	}
+	if text.String() != " world!" || text.Len() != 7 {
+		t.Errorf("Expected \" world!\", got %q (len %d)", text.String(), text.Len())
+	}
+}
+
+// TestTextConcurrentInsertsSplitRuns tests concurrent edits inside one run
+func TestTextConcurrentInsertsSplitRuns(t *testing.T) {
+	replica1 := NewText("replica1")
+	replica2 := NewText("site2")
+
+	replica1.InsertText(0, "hello world")
+	replica2.Merge(replica1)
+
+	replica1.InsertText(5, " big")
+	replica2.InsertText(5, " small")
+	replica2.DeleteText(0, 1)
+	replica1.DeleteText(9, 2)
+
+	syncTexts(replica1, replica2)
+
+	got := replica1.String()
+	if got != "ello big smallorld" && got != "ello small bigorld" {
+		t.Errorf("Unexpected merge result: %q", got)
+	}
+	if replica1.String() != replica2.String() {
+		t.Errorf("Replicas did not converge! R1: %q, R2: %q", replica1.String(), replica2.String())
+	}
+}
+
+// TestTextRunsStayCompact tests that typing one key at a time extends one
+// run instead of nesting positions, and that a remote insert after the run
+// ends it
+func TestTextRunsStayCompact(t *testing.T) {
+	replica1 := NewText("replica1")
+	replica2 := NewText("site2")
+
+	replica1.InsertText(0, "hello world")
+	for i, c := range ", typed one key at a time," {
+		replica1.InsertText(5+i, string(c))
+	}
+	if replica1.String() != "hello, typed one key at a time, world" {
+		t.Fatalf("Unexpected text %q", replica1.String())
+	}
+	typed := textPositions(replica1)[5:31]
+	for _, pos := range typed[1:] {
+		if len(pos) != len(typed[0]) || pos[:len(pos)-textRunWidth] != typed[0][:len(pos)-textRunWidth] {
+			t.Fatalf("Typed characters should share one run, got %q and %q", typed[0], pos)
+		}
+	}
+
+	// A character another replica put after the run's end is not skipped
+	replica2.Merge(replica1)
+	replica2.InsertText(31, "!")
+	replica1.Merge(replica2)
+	replica1.InsertText(31, "?")
+	replica2.Merge(replica1)
+	if replica1.String() != "hello, typed one key at a time,? !world" &&
+		replica1.String() != "hello, typed one key at a time,?! world" {
+		t.Errorf("Unexpected text %q", replica1.String())
+	}
+	if replica1.String() != replica2.String() {
+		t.Errorf("Replicas did not converge! R1: %q, R2: %q", replica1.String(), replica2.String())
+	}
+}
+
+// TestTextSelections tests selections and cursors across remote edits
+func TestTextSelections(t *testing.T) {
+	replica1 := NewText("replica1")
+	replica2 := NewText("site2")
+
+	replica1.InsertText(0, "hello world")
+	replica2.Merge(replica1)
+
+	sel := replica1.Select(6, 11) // "world"
+	caret := replica1.CursorAt(5, SideAfter)
+	collapsed := replica1.Select(5, 5)
+
+	// Text typed at both edges of the selection stays outside it
+	replica2.InsertText(11, "!")
+	replica2.InsertText(6, "big ")
+	replica2.InsertText(5, ",")
+	replica2.InsertText(0, "oh, ")
+	replica1.Merge(replica2)
+
+	from, to, ok := replica1.ResolveSelection(sel)
+	if !ok || replica1.String()[from:to] != "world" {
+		t.Errorf("Selection resolved to [%d, %d) in %q", from, to, replica1.String())
+	}
+	if index, _ := replica1.ResolveCursor(caret); index != 9 {
+		t.Errorf("Expected caret at 9, got %d", index)
+	}
+	if from, to, _ := replica1.ResolveSelection(collapsed); from != 10 || to != 10 {
+		t.Errorf("Collapsed selection should stay collapsed after the text typed into it, got [%d, %d)", from, to)
+	}
+
+	// A deleted character resolves to the gap it left
+	replica2.Merge(replica1)
+	replica2.DeleteText(5, 4) // "ello"
+	replica1.Merge(replica2)
+	if index, _ := replica1.ResolveCursor(caret); index != 5 {
+		t.Errorf("Expected caret of deleted character at 5, got %d", index)
+	}
+}
+
+// TestTextSyncsLikeAnArray tests that operations, deltas, encodings, marks,
+// undo and Compact work on text
+func TestTextSyncsLikeAnArray(t *testing.T) {
+	replica1 := NewText("replica1")
+	replica2 := NewText("site2")
+	ops := collectOps(replica1.MArrayCRDT)
+	um := NewUndoManager(replica1.MArrayCRDT, time.Hour)
+
+	replica1.InsertText(0, "hello world")
+	replica1.DeleteText(0, 1)
+	replica1.AddMark(0, 4, "bold", true, ExpandAfter)
+
+	// Operations in any order
+	shuffled := append([]Operation[rune](nil), *ops...)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	if err := replica2.Apply(shuffled...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if replica2.String() != "ello world" || !reflect.DeepEqual(replica2.Spans(), replica1.Spans()) {
+		t.Errorf("Operations gave %q with spans %v", replica2.String(), replica2.Spans())
+	}
+
+	// Deltas and both encodings
+	replica1.InsertText(10, "!")
+	replica2.MergeDelta(replica1.DeltaSince(replica2.Clock()))
+	fromBinary := roundTrip(t, replica1.MArrayCRDT)
+	jsonData, err := replica1.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	fromJSON := NewText("other")
+	if err := fromJSON.UnmarshalJSON(jsonData); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	for _, got := range []string{replica2.String(), string(fromBinary.ToSlice()), fromJSON.String()} {
+		if got != "ello world!" {
+			t.Errorf("Expected \"ello world!\", got %q", got)
+		}
+	}
+
+	// Undo takes back the whole typing session
+	if !um.Undo() || replica1.String() != "" {
+		t.Errorf("Undo should remove the typed text, got %q", replica1.String())
+	}
+
+	// Tombstones are collected once every member saw them, except the two
+	// the bold mark is anchored to
+	joinAll(replica1.MArrayCRDT, replica2.MArrayCRDT)
+	syncAll(replica1.MArrayCRDT, replica2.MArrayCRDT)
+	if removed := replica1.Compact(); removed != 10 {
+		t.Errorf("Expected 10 collected characters, got %d", removed)
+	}
+}
+
+// TestTextRandomizedConvergence tests convergence under random concurrent edits
+func TestTextRandomizedConvergence(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	replicas := []*Text{NewText("replica1"), NewText("site2"), NewText("r3")}
+
+	for round := 0; round < 40; round++ {
+		for _, r := range replicas {
+			for i := 0; i < 3; i++ {
+				if rng.Intn(3) == 0 {
+					r.DeleteText(rng.Intn(r.Len()+1), rng.Intn(4))
+				} else {
+					r.InsertText(rng.Intn(r.Len()+1), strings.Repeat(fmt.Sprint(round%10), 1+rng.Intn(3)))
+				}
+			}
+		}
+		if a, b := replicas[rng.Intn(3)], replicas[rng.Intn(3)]; a != b {
+			a.Merge(b)
+		}
+	}
+	syncTexts(replicas...)
+
+	for _, r := range replicas[1:] {
+		if r.String() != replicas[0].String() {
+			t.Fatalf("Replicas did not converge! R1: %q, R2: %q", replicas[0].String(), r.String())
+		}
+	}
+
+	// Every character position is unique and in order
+	for _, r := range replicas {
+		positions := textPositions(r)
+		for i := 1; i < len(positions); i++ {
+			if positions[i] <= positions[i-1] {
+				t.Fatalf("%s: position %q out of order after %q", r.replicaID, positions[i], positions[i-1])
+			}
+		}
+	}
+}
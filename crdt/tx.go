@@ -0,0 +1,275 @@
+package marraycrdt
+
+// Transactions
+//
+// Transact runs several mutators under a single lock. Observers see one batch
+// of change events, OnOperations handlers receive one batch of operations and
+// an UndoManager records one undo item, all delivered after the transaction
+// committed. Every field still gets its own clock, so remote replicas merge a
+// transaction exactly like the same edits made one by one.
+//
+// If the function returns an error or panics, every element it touched is
+// restored together with the replica clock and nothing is emitted.
+
+// Tx exposes the array mutators inside Transact. It must not be used after the
+// function returns, and the function must not call methods of the array itself.
+type Tx[T any] struct {
+	ma *MArrayCRDT[T]
+}
+
+// txJournal remembers the state a transaction has to restore on rollback
+type txJournal[T any] struct {
+	// before holds the original element for every touched ID, or nil for
+	// elements the transaction created
+	before map[string]*Element[T]
+	// marks holds the IDs of the marks the transaction added
+	marks []string
+	// captureMarks is the number of marks the change capture held
+	captureMarks int
+	clock        *VectorClock
+	outbox       int
+	undoLog      int
+	// undoStamps holds the undo stamp of every field the transaction
+	// captured, as it was before
+	undoStamps map[undoField]journaledStamp
+}
+
+// journaledStamp is an undo stamp and the clock it had
+type journaledStamp struct {
+	stamp *undoStamp
+	clock *VectorClock
+}
+
+// Transact runs fn atomically and returns its error. Changes made by fn are
+// rolled back when it returns an error or panics.
+func (ma *MArrayCRDT[T]) Transact(fn func(tx *Tx[T]) error) error {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	ma.tx = &txJournal[T]{
+		before:     make(map[string]*Element[T]),
+		clock:      ma.clock.Clone(),
+		outbox:     len(ma.outbox),
+		undoLog:    len(ma.undoLog),
+		undoStamps: make(map[undoField]journaledStamp),
+	}
+	if ma.capture != nil {
+		ma.tx.captureMarks = len(ma.capture.marks)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			ma.rollbackLocked()
+			ma.tx = nil
+			panic(r)
+		}
+		ma.tx = nil
+	}()
+
+	if err := fn(&Tx[T]{ma: ma}); err != nil {
+		ma.rollbackLocked()
+		return err
+	}
+	return nil
+}
+
+// touchLocked is called by local mutators before they change a field of elem,
+// and right after an insert created it (must hold lock)
+func (ma *MArrayCRDT[T]) touchLocked(op OpType, elem *Element[T]) {
+	ma.noteChangeLocked(elem.ID)
+	ma.recordUndoLocked(op, elem)
+
+	if ma.tx == nil {
+		return
+	}
+	if _, seen := ma.tx.before[elem.ID]; seen {
+		return
+	}
+	if op == OpInsert {
+		ma.tx.before[elem.ID] = nil
+		return
+	}
+	ma.tx.before[elem.ID] = forkElement(elem, ma.replicaID)
+}
+
+// rollbackLocked restores the state recorded by the running transaction
+// (must hold lock)
+func (ma *MArrayCRDT[T]) rollbackLocked() {
+	for id, elem := range ma.tx.before {
+		if elem == nil {
+			delete(ma.items, id)
+		} else {
+			ma.items[id] = elem
+		}
+		ma.reorderLocked(id)
+	}
+	for _, id := range ma.tx.marks {
+		delete(ma.marks, id)
+	}
+	if ma.capture != nil {
+		ma.capture.marks = ma.capture.marks[:ma.tx.captureMarks]
+	}
+
+	ma.clock = ma.tx.clock
+	ma.outbox = ma.outbox[:ma.tx.outbox]
+	ma.undoLog = ma.undoLog[:ma.tx.undoLog]
+	for field, journaled := range ma.tx.undoStamps {
+		if journaled.stamp == nil {
+			delete(ma.undoStamps, field)
+			continue
+		}
+		journaled.stamp.clock = journaled.clock
+		ma.undoStamps[field] = journaled.stamp
+	}
+}
+
+// Push adds element to end
+func (tx *Tx[T]) Push(value T) string {
+	return tx.ma.pushLocked(value)
+}
+
+// Unshift adds element to beginning
+func (tx *Tx[T]) Unshift(value T) string {
+	return tx.ma.unshiftLocked(value)
+}
+
+// Insert adds element at specific index
+func (tx *Tx[T]) Insert(index int, value T) string {
+	return tx.ma.insertLocked(index, value)
+}
+
+// Pop removes and returns last element
+func (tx *Tx[T]) Pop() (T, bool) {
+	return tx.ma.popLocked()
+}
+
+// Shift removes and returns first element
+func (tx *Tx[T]) Shift() (T, bool) {
+	return tx.ma.shiftLocked()
+}
+
+// Set updates value of element
+func (tx *Tx[T]) Set(id string, value T) bool {
+	return tx.ma.setLocked(id, value)
+}
+
+// Update replaces the value of an element with fn(value)
+func (tx *Tx[T]) Update(id string, fn func(value T) T) bool {
+	return tx.ma.updateLocked(id, fn)
+}
+
+// Delete removes element by ID
+func (tx *Tx[T]) Delete(id string) bool {
+	return tx.ma.deleteElementLocked(id)
+}
+
+// Move element to specific position
+func (tx *Tx[T]) Move(id string, toIndex int) bool {
+	return tx.ma.moveLocked(id, toIndex)
+}
+
+// MoveAfter moves element after another element
+func (tx *Tx[T]) MoveAfter(id string, afterID string) bool {
+	return tx.ma.moveAfterLocked(id, afterID)
+}
+
+// MoveBefore moves element before another element
+func (tx *Tx[T]) MoveBefore(id string, beforeID string) bool {
+	return tx.ma.moveBeforeLocked(id, beforeID)
+}
+
+// Swap swaps two elements
+func (tx *Tx[T]) Swap(id1, id2 string) bool {
+	return tx.ma.swapLocked(id1, id2)
+}
+
+// Sort array with custom comparison
+func (tx *Tx[T]) Sort(less func(a, b T) bool) {
+	tx.ma.sortLocked(less)
+}
+
+// Reverse reverses the array order
+func (tx *Tx[T]) Reverse() {
+	tx.ma.reverseLocked()
+}
+
+// Shuffle randomizes array order
+func (tx *Tx[T]) Shuffle() {
+	tx.ma.shuffleLocked()
+}
+
+// Rotate rotates array by n positions
+func (tx *Tx[T]) Rotate(n int) {
+	tx.ma.rotateLocked(n)
+}
+
+// Clear removes all elements
+func (tx *Tx[T]) Clear() {
+	tx.ma.clearLocked()
+}
+
+// InsertRange inserts values at index as one contiguous run
+func (tx *Tx[T]) InsertRange(index int, values []T) []string {
+	return tx.ma.insertRangeLocked(index, values)
+}
+
+// DeleteRange deletes the live elements in [from, to)
+func (tx *Tx[T]) DeleteRange(from, to int) int {
+	return tx.ma.deleteRangeLocked(from, to)
+}
+
+// MoveRange moves the run from fromID through toID after afterID
+func (tx *Tx[T]) MoveRange(fromID, toID, afterID string) bool {
+	return tx.ma.moveRangeLocked(fromID, toID, afterID)
+}
+
+// AddMark sets key to value for the live elements in [from, to)
+func (tx *Tx[T]) AddMark(from, to int, key string, value any, expand MarkExpand) string {
+	return tx.ma.addMarkLocked(from, to, key, value, expand)
+}
+
+// RemoveMark removes key from the live elements in [from, to)
+func (tx *Tx[T]) RemoveMark(from, to int, key string, expand MarkExpand) string {
+	return tx.ma.addMarkLocked(from, to, key, nil, expand)
+}
+
+// Get returns element at index, including changes made so far
+func (tx *Tx[T]) Get(index int) (T, bool) {
+	elem := tx.ma.orderLocked().at(index)
+	if elem == nil {
+		var zero T
+		return zero, false
+	}
+
+	return elem.Value.Data, true
+}
+
+// Len returns the number of non-deleted elements
+func (tx *Tx[T]) Len() int {
+	return tx.ma.orderLocked().len()
+}
+
+// ToSlice returns array as slice
+func (tx *Tx[T]) ToSlice() []T {
+	sorted := tx.ma.getSortedElementsLocked()
+	result := make([]T, 0, len(sorted))
+
+	for _, elem := range sorted {
+		result = append(result, elem.Value.Data)
+	}
+
+	return result
+}
+
+// IDs returns all element IDs in order
+func (tx *Tx[T]) IDs() []string {
+	sorted := tx.ma.getSortedElementsLocked()
+	result := make([]string, 0, len(sorted))
+
+	for _, elem := range sorted {
+		result = append(result, elem.ID)
+	}
+
+	return result
+}
@@ -0,0 +1,133 @@
+package marraycrdt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestTransactGroupsChanges tests that a transaction produces one batch of events and operations
+func TestTransactGroupsChanges(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+	idC := replica1.Push("C")
+	replica2.Merge(replica1)
+
+	ops := collectOps(replica1)
+	batches := collectEvents(replica1)
+	var opBatches int
+	replica1.OnOperations(func([]Operation[string]) { opBatches++ })
+
+	err := replica1.Transact(func(tx *Tx[string]) error {
+		tx.Move(idA, 2)
+		tx.MoveBefore(idC, idB)
+		tx.Set(idB, "B2")
+		if got := tx.ToSlice(); !reflect.DeepEqual(got, []string{"C", "B2", "A"}) {
+			t.Errorf("Transaction should see its own changes, got %v", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	if opBatches != 1 || len(*ops) != 3 {
+		t.Errorf("Expected one batch of 3 operations, got %d batches and %d ops", opBatches, len(*ops))
+	}
+	if len(*batches) != 1 {
+		t.Errorf("Expected one batch of change events, got %d", len(*batches))
+	}
+
+	if err := replica2.Apply(*ops...); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestTransactRollback tests that a failed transaction leaves no trace
+func TestTransactRollback(t *testing.T) {
+	replica1 := New[string]("replica1")
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+
+	before := replica1.ToSlice()
+	clock := replica1.Clock()
+
+	ops := collectOps(replica1)
+	batches := collectEvents(replica1)
+	um := newTestUndoManager(replica1)
+
+	errAbort := errors.New("abort")
+	err := replica1.Transact(func(tx *Tx[string]) error {
+		tx.Push("C")
+		tx.Set(idA, "A2")
+		tx.Delete(idB)
+		tx.Reverse()
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Expected abort error, got %v", err)
+	}
+
+	if !reflect.DeepEqual(replica1.ToSlice(), before) {
+		t.Errorf("Expected %v after rollback, got %v", before, replica1.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.Clock().toMap(), clock.toMap()) {
+		t.Errorf("Clock should be restored, got %v", replica1.Clock().toMap())
+	}
+	if len(*ops) != 0 || len(*batches) != 0 || um.CanUndo() {
+		t.Errorf("Rolled back transaction should emit nothing")
+	}
+	if len(replica1.items) != 2 {
+		t.Errorf("Inserted element should be removed, got %d items", len(replica1.items))
+	}
+}
+
+// TestTransactPanicRollback tests that a panic rolls back and unlocks the array
+func TestTransactPanicRollback(t *testing.T) {
+	replica1 := New[string]("replica1")
+	_ = replica1.Push("A")
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected panic to propagate")
+			}
+		}()
+		_ = replica1.Transact(func(tx *Tx[string]) error {
+			tx.Push("B")
+			panic("boom")
+		})
+	}()
+
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"A"}) {
+		t.Errorf("Expected [A] after panic, got %v", replica1.ToSlice())
+	}
+}
+
+// TestTransactIsOneUndoUnit tests that undo reverts a whole transaction
+func TestTransactIsOneUndoUnit(t *testing.T) {
+	replica1 := New[string]("replica1")
+	_ = replica1.Push("A")
+	um := newTestUndoManager(replica1)
+
+	_ = replica1.Transact(func(tx *Tx[string]) error {
+		id := tx.Push("B")
+		tx.Push("C")
+		tx.Set(id, "B2")
+		return nil
+	})
+
+	um.Undo()
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"A"}) {
+		t.Errorf("Expected [A] after undo, got %v", replica1.ToSlice())
+	}
+	if um.CanUndo() {
+		t.Errorf("Transaction should be a single undo item")
+	}
+}
@@ -0,0 +1,345 @@
+package marraycrdt
+
+import (
+	"sync"
+	"time"
+)
+
+// Undo and redo
+//
+// Local mutators capture the state of every field they are about to change.
+// An UndoManager groups those captures into stack items and reverts an item
+// by running ordinary local mutators: the reverted fields get fresh clocks,
+// are emitted through OnOperations and converge like any other edit. Changes
+// that arrive through Merge, MergeDelta or Apply are never captured, so undo
+// only touches what this replica did itself.
+//
+// Undo is selective: every step remembers the clock its write left on the
+// field, moved along by later local writes and reverts of the same field,
+// and reverting an item skips a step whose field has since been written by
+// someone else, whose element has since been deleted by someone
+// else (an undo never resurrects a remote delete) or compacted away.
+// Marks cannot be taken back, so a mark is undone by new marks that restore
+// the values its key had over the same elements.
+
+// DefaultCaptureTimeout groups local changes made in quick succession into a
+// single undo item
+const DefaultCaptureTimeout = 500 * time.Millisecond
+
+// undoStep is the state of one field before a local mutator changed it
+type undoStep[T any] struct {
+	op       OpType
+	id       string
+	value    T
+	position Position
+	deleted  bool
+
+	// stamp holds the clock the local write left on the field; a revert
+	// only touches the field while it still holds that clock
+	stamp *undoStamp
+
+	// marks restore the key of an OpMark step
+	marks []*Mark
+}
+
+// undoField names one field of an element: the value (OpSet), the index
+// (OpMove) or the delete status (OpDelete)
+type undoField struct {
+	id string
+	op OpType
+}
+
+// undoStamp is the clock the latest local write left on a field. Steps that
+// capture writes made while the field only changed locally share one stamp,
+// so a later local write or revert moves all of them along.
+type undoStamp struct {
+	clock *VectorClock
+}
+
+// recordUndoLocked captures the current state of the field op is about to
+// change (must hold lock). Inserts are recorded after the element exists.
+func (ma *MArrayCRDT[T]) recordUndoLocked(op OpType, elem *Element[T]) {
+	if len(ma.undoRecorders) == 0 {
+		return
+	}
+
+	ma.undoLog = append(ma.undoLog, undoStep[T]{
+		op:       op,
+		id:       elem.ID,
+		value:    elem.Value.Data,
+		position: elem.Index.Position,
+		deleted:  elem.Deleted,
+		stamp:    ma.undoStampLocked(op, elem),
+	})
+}
+
+// undoStampLocked returns the stamp for a local write of op to elem (must
+// hold lock). A field that someone else wrote after the last local write
+// gets a new stamp, leaving the steps of earlier writes behind.
+func (ma *MArrayCRDT[T]) undoStampLocked(op OpType, elem *Element[T]) *undoStamp {
+	if op == OpInsert {
+		return nil
+	}
+
+	field := undoField{elem.ID, op}
+	stamp := ma.undoStamps[field]
+	if ma.tx != nil {
+		if _, seen := ma.tx.undoStamps[field]; !seen {
+			ma.tx.undoStamps[field] = journaledStamp{stamp, stampClock(stamp)}
+		}
+	}
+	if stamp != nil && sameClock(undoFieldClock(op, elem), stamp.clock) {
+		return stamp
+	}
+
+	stamp = &undoStamp{clock: undoFieldClock(op, elem).Clone()}
+	if ma.undoStamps == nil {
+		ma.undoStamps = make(map[undoField]*undoStamp)
+	}
+	ma.undoStamps[field] = stamp
+	return stamp
+}
+
+// stampUndoLocked moves the stamp of the field op wrote on elem to the clock
+// the local write left there (must hold lock)
+func (ma *MArrayCRDT[T]) stampUndoLocked(op OpType, elem *Element[T]) {
+	if stamp := ma.undoStamps[undoField{elem.ID, op}]; stamp != nil {
+		stamp.clock = undoFieldClock(op, elem).Clone()
+	}
+}
+
+// undoFieldClock returns the clock of the field of elem that op writes
+func undoFieldClock[T any](op OpType, elem *Element[T]) *VectorClock {
+	switch op {
+	case OpSet:
+		return elem.Value.VectorClock
+	case OpMove:
+		return elem.Index.VectorClock
+	default:
+		return elem.DeleteClock
+	}
+}
+
+// stampClock returns the clock of a stamp that may be nil
+func stampClock(stamp *undoStamp) *VectorClock {
+	if stamp == nil {
+		return nil
+	}
+	return stamp.clock
+}
+
+// recordMarkUndoLocked captures the values the key of a new mark had over
+// its range (must hold lock)
+func (ma *MArrayCRDT[T]) recordMarkUndoLocked(mark *Mark) {
+	if len(ma.undoRecorders) == 0 {
+		return
+	}
+
+	from, to, _ := ma.markRangeLocked(mark)
+	ma.undoLog = append(ma.undoLog, undoStep[T]{
+		op:    OpMark,
+		id:    mark.ID,
+		marks: ma.keyRunsLocked(from, to, mark.Key, mark.Expand),
+	})
+}
+
+// revert applies the inverse of steps, newest first, and returns the steps
+// that undo the revert itself
+func (ma *MArrayCRDT[T]) revert(steps []undoStep[T]) []undoStep[T] {
+	defer ma.flushOps()
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	ma.beginChangeLocked(ma.replicaID)
+
+	// Keep the revert out of the regular capture stream
+	captured := ma.undoLog
+	ma.undoLog = nil
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		if step.op == OpMark {
+			ma.restoreMarksLocked(step.marks)
+			continue
+		}
+		elem, exists := ma.items[step.id]
+		if !exists {
+			continue
+		}
+		if step.stamp != nil && !sameClock(undoFieldClock(step.op, elem), step.stamp.clock) {
+			// Someone else wrote the field after this replica did
+			continue
+		}
+
+		switch step.op {
+		case OpInsert:
+			ma.deleteElementLocked(step.id)
+		case OpDelete:
+			if elem.Deleted {
+				ma.moveToLocked(elem, step.position)
+			}
+		case OpSet:
+			if !elem.Deleted {
+				ma.setValueLocked(elem, step.value)
+			}
+		case OpMove:
+			if step.deleted {
+				// The move resurrected the element
+				ma.deleteElementLocked(step.id)
+			} else if !elem.Deleted {
+				ma.moveToLocked(elem, step.position)
+			}
+		}
+	}
+
+	inverse := ma.undoLog
+	ma.undoLog = captured
+	return inverse
+}
+
+// restoreMarksLocked adds fresh copies of marks whose edge elements still
+// exist (must hold lock)
+func (ma *MArrayCRDT[T]) restoreMarksLocked(marks []*Mark) {
+	for _, mark := range marks {
+		if _, ok := ma.items[mark.Start]; !ok {
+			continue
+		}
+		if _, ok := ma.items[mark.End]; mark.End != "" && !ok {
+			continue
+		}
+		restored := *mark
+		ma.putMarkLocked(&restored)
+	}
+}
+
+// UndoManager keeps undo and redo stacks for the local changes of one replica
+type UndoManager[T any] struct {
+	mu             sync.Mutex
+	ma             *MArrayCRDT[T]
+	captureTimeout time.Duration
+	now            func() time.Time
+
+	undoStack   [][]undoStep[T]
+	redoStack   [][]undoStep[T]
+	lastCapture time.Time
+	stopped     bool
+}
+
+// NewUndoManager starts capturing the local changes of ma. Changes made
+// within captureTimeout of each other form one undo item; a non-positive
+// timeout uses DefaultCaptureTimeout.
+func NewUndoManager[T any](ma *MArrayCRDT[T], captureTimeout time.Duration) *UndoManager[T] {
+	if captureTimeout <= 0 {
+		captureTimeout = DefaultCaptureTimeout
+	}
+
+	um := &UndoManager[T]{
+		ma:             ma,
+		captureTimeout: captureTimeout,
+		now:            time.Now,
+	}
+
+	ma.mu.Lock()
+	ma.undoRecorders = append(ma.undoRecorders, um.capture)
+	ma.mu.Unlock()
+
+	return um
+}
+
+// capture adds the steps of one local mutator call to the undo stack
+func (um *UndoManager[T]) capture(steps []undoStep[T]) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	now := um.now()
+	top := len(um.undoStack) - 1
+	if top >= 0 && !um.stopped && now.Sub(um.lastCapture) < um.captureTimeout {
+		um.undoStack[top] = append(um.undoStack[top], steps...)
+	} else {
+		um.undoStack = append(um.undoStack, append([]undoStep[T](nil), steps...))
+	}
+
+	um.lastCapture = now
+	um.stopped = false
+	um.redoStack = nil
+}
+
+// StopCapturing makes the next local change start a new undo item
+func (um *UndoManager[T]) StopCapturing() {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	um.stopped = true
+}
+
+// Undo reverts the most recent undo item and reports whether there was one
+func (um *UndoManager[T]) Undo() bool {
+	steps, ok := um.pop(&um.undoStack)
+	if !ok {
+		return false
+	}
+
+	inverse := um.ma.revert(steps)
+
+	um.mu.Lock()
+	um.redoStack = append(um.redoStack, inverse)
+	um.stopped = true
+	um.mu.Unlock()
+
+	return true
+}
+
+// Redo reapplies the most recently undone item and reports whether there was one
+func (um *UndoManager[T]) Redo() bool {
+	steps, ok := um.pop(&um.redoStack)
+	if !ok {
+		return false
+	}
+
+	inverse := um.ma.revert(steps)
+
+	um.mu.Lock()
+	um.undoStack = append(um.undoStack, inverse)
+	um.stopped = true
+	um.mu.Unlock()
+
+	return true
+}
+
+func (um *UndoManager[T]) pop(stack *[][]undoStep[T]) ([]undoStep[T], bool) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	n := len(*stack)
+	if n == 0 {
+		return nil, false
+	}
+
+	steps := (*stack)[n-1]
+	*stack = (*stack)[:n-1]
+	return steps, true
+}
+
+// CanUndo reports whether there is an item to undo
+func (um *UndoManager[T]) CanUndo() bool {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	return len(um.undoStack) > 0
+}
+
+// CanRedo reports whether there is an item to redo
+func (um *UndoManager[T]) CanRedo() bool {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	return len(um.redoStack) > 0
+}
+
+// Clear drops both stacks
+func (um *UndoManager[T]) Clear() {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	um.undoStack = nil
+	um.redoStack = nil
+}
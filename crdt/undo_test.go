@@ -0,0 +1,290 @@
+package marraycrdt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestUndoManager returns a manager whose clock moves past the capture
+// timeout on every change, so each mutator call is its own undo item
+func newTestUndoManager[T any](ma *MArrayCRDT[T]) *UndoManager[T] {
+	um := NewUndoManager(ma, time.Second)
+	now := time.Unix(0, 0)
+	um.now = func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	}
+	return um
+}
+
+// TestUndoRedoBasicOperations tests undo and redo of insert, set and delete
+func TestUndoRedoBasicOperations(t *testing.T) {
+	replica1 := New[string]("replica1")
+	um := newTestUndoManager(replica1)
+
+	idA := replica1.Push("A")
+	_ = replica1.Push("B")
+	replica1.Set(idA, "A2")
+	replica1.Delete(idA)
+
+	steps := [][]string{
+		{"A2", "B"},
+		{"A", "B"},
+		{"A"},
+		nil,
+	}
+	for i, expected := range steps {
+		if !um.Undo() {
+			t.Fatalf("Undo %d failed", i)
+		}
+		if got := replica1.ToSlice(); len(got) != len(expected) || (len(got) > 0 && !reflect.DeepEqual(got, expected)) {
+			t.Errorf("After undo %d: expected %v, got %v", i, expected, got)
+		}
+	}
+	if um.Undo() {
+		t.Errorf("Undo should fail on an empty stack")
+	}
+
+	for i := len(steps) - 2; i >= 0; i-- {
+		if !um.Redo() {
+			t.Fatalf("Redo failed")
+		}
+		if got := replica1.ToSlice(); !reflect.DeepEqual(got, steps[i]) {
+			t.Errorf("After redo: expected %v, got %v", steps[i], got)
+		}
+	}
+	if !um.Redo() {
+		t.Fatalf("Final redo failed")
+	}
+	if got := replica1.ToSlice(); !reflect.DeepEqual(got, []string{"B"}) {
+		t.Errorf("After all redos: expected [B], got %v", got)
+	}
+}
+
+// TestUndoBulkOperations tests that sort, reverse, rotate, swap and move restore the previous order
+func TestUndoBulkOperations(t *testing.T) {
+	replica1 := New[int]("replica1")
+	for _, v := range []int{3, 1, 4, 2} {
+		_ = replica1.Push(v)
+	}
+	um := newTestUndoManager(replica1)
+	original := replica1.ToSlice()
+	ids := replica1.IDs()
+
+	mutations := map[string]func(){
+		"sort":    func() { replica1.Sort(func(a, b int) bool { return a < b }) },
+		"reverse": func() { replica1.Reverse() },
+		"rotate":  func() { replica1.Rotate(1) },
+		"swap":    func() { replica1.Swap(ids[0], ids[3]) },
+		"move":    func() { replica1.Move(ids[0], 2) },
+	}
+	for name, mutate := range mutations {
+		mutate()
+		if !um.Undo() {
+			t.Fatalf("%s: undo failed", name)
+		}
+		if got := replica1.ToSlice(); !reflect.DeepEqual(got, original) {
+			t.Errorf("%s: expected %v after undo, got %v", name, original, got)
+		}
+	}
+}
+
+// TestUndoOnlyRevertsLocalChanges tests that remote edits survive a local undo
+func TestUndoOnlyRevertsLocalChanges(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	um := newTestUndoManager(replica1)
+
+	_ = replica1.Push("A")
+	replica2.Merge(replica1)
+	_ = replica2.Push("B")
+	replica1.Merge(replica2)
+
+	if !um.Undo() {
+		t.Fatalf("Undo failed")
+	}
+	if um.Undo() {
+		t.Errorf("Remote insert should not be on the undo stack")
+	}
+
+	syncAll(replica1, replica2)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"B"}) {
+		t.Errorf("Expected [B], got %v", replica1.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestUndoDoesNotResurrectRemoteDelete tests that undoing a move leaves a remote delete in place
+func TestUndoDoesNotResurrectRemoteDelete(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	_ = replica1.Push("B")
+	replica2.Merge(replica1)
+
+	um := newTestUndoManager(replica1)
+	replica1.Move(idA, 1)
+	replica2.Merge(replica1)
+	replica2.Delete(idA)
+	replica1.Merge(replica2)
+
+	um.Undo()
+	syncAll(replica1, replica2)
+
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"B"}) {
+		t.Errorf("Expected [B], got %v", replica1.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestUndoSkipsRemotelyOverwrittenSet tests that undoing a set keeps a
+// remote value written after it, and still reverts the local sets of
+// untouched elements in the same item
+func TestUndoSkipsRemotelyOverwrittenSet(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	idB := replica1.Push("B")
+	replica2.Merge(replica1)
+
+	um := NewUndoManager(replica1, time.Hour)
+	replica1.Set(idA, "mine")
+	replica1.Set(idB, "mine too")
+	replica2.Merge(replica1)
+	replica2.Set(idA, "theirs")
+	replica1.Merge(replica2)
+
+	if !um.Undo() {
+		t.Fatalf("Undo failed")
+	}
+	syncAll(replica1, replica2)
+
+	if expected := []string{"theirs", "B"}; !reflect.DeepEqual(replica1.ToSlice(), expected) {
+		t.Errorf("Expected %v, got %v", expected, replica1.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestUndoSkipsRemotelyOverwrittenMove tests that undoing a move keeps a
+// remote move made after it
+func TestUndoSkipsRemotelyOverwrittenMove(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+
+	idA := replica1.Push("A")
+	_ = replica1.Push("B")
+	_ = replica1.Push("C")
+	replica2.Merge(replica1)
+
+	um := newTestUndoManager(replica1)
+	replica1.Move(idA, 2)
+	replica2.Merge(replica1)
+	replica2.Move(idA, 1)
+	replica1.Merge(replica2)
+
+	if !um.Undo() {
+		t.Fatalf("Undo failed")
+	}
+	syncAll(replica1, replica2)
+
+	if expected := []string{"B", "A", "C"}; !reflect.DeepEqual(replica1.ToSlice(), expected) {
+		t.Errorf("Expected %v, got %v", expected, replica1.ToSlice())
+	}
+	if !reflect.DeepEqual(replica1.ToSlice(), replica2.ToSlice()) {
+		t.Errorf("Replicas did not converge! R1: %v, R2: %v", replica1.ToSlice(), replica2.ToSlice())
+	}
+}
+
+// TestUndoCaptureTimeout tests that quick successive changes form one undo item
+func TestUndoCaptureTimeout(t *testing.T) {
+	replica1 := New[string]("replica1")
+	um := NewUndoManager(replica1, time.Second)
+	now := time.Unix(0, 0)
+	um.now = func() time.Time { return now }
+
+	_ = replica1.Push("A")
+	now = now.Add(100 * time.Millisecond)
+	_ = replica1.Push("B")
+	now = now.Add(2 * time.Second)
+	_ = replica1.Push("C")
+	um.StopCapturing()
+	_ = replica1.Push("D")
+
+	um.Undo()
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"A", "B", "C"}) {
+		t.Errorf("StopCapturing should split items, got %v", replica1.ToSlice())
+	}
+	um.Undo()
+	if !reflect.DeepEqual(replica1.ToSlice(), []string{"A", "B"}) {
+		t.Errorf("Expected [A B], got %v", replica1.ToSlice())
+	}
+	um.Undo()
+	if len(replica1.ToSlice()) != 0 {
+		t.Errorf("A and B should be undone together, got %v", replica1.ToSlice())
+	}
+}
+
+// TestUndoEmitsOperations tests that undo is replicated through the operation stream
+func TestUndoEmitsOperations(t *testing.T) {
+	replica1 := New[string]("replica1")
+	replica2 := New[string]("site2")
+	replica1.OnOperations(func(ops []Operation[string]) {
+		if err := replica2.Apply(ops...); err != nil {
+			t.Errorf("Apply failed: %v", err)
+		}
+	})
+	um := newTestUndoManager(replica1)
+
+	id := replica1.Push("A")
+	replica1.Set(id, "B")
+	um.Undo()
+
+	if !reflect.DeepEqual(replica2.ToSlice(), []string{"A"}) {
+		t.Errorf("Expected [A] on site2, got %v", replica2.ToSlice())
+	}
+}
+
+// TestUndoSetsInSeparateItems tests that later local writes and reverts of a
+// field do not count as remote writes when an older item is undone
+func TestUndoSetsInSeparateItems(t *testing.T) {
+	replica1 := New[string]("replica1")
+	id := replica1.Push("A")
+
+	um := newTestUndoManager(replica1)
+	replica1.Set(id, "B")
+	if err := replica1.Transact(func(tx *Tx[string]) error {
+		tx.Set(id, "lost")
+		return errors.New("abort")
+	}); err == nil {
+		t.Fatalf("Transact should fail")
+	}
+	replica1.Set(id, "C")
+
+	for _, expected := range []string{"B", "A"} {
+		if !um.Undo() {
+			t.Fatalf("Undo failed")
+		}
+		if got := replica1.ToSlice(); !reflect.DeepEqual(got, []string{expected}) {
+			t.Errorf("Expected [%s], got %v", expected, got)
+		}
+	}
+	for _, expected := range []string{"B", "C"} {
+		if !um.Redo() {
+			t.Fatalf("Redo failed")
+		}
+		if got := replica1.ToSlice(); !reflect.DeepEqual(got, []string{expected}) {
+			t.Errorf("Expected [%s], got %v", expected, got)
+		}
+	}
+}